@@ -0,0 +1,225 @@
+package instana
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// NonFinitePolicy controls how aggregators treat NaN and infinite values.
+type NonFinitePolicy int
+
+const (
+	// SkipNonFinite ignores NaN and infinite values, a timestamp with no finite values is omitted.
+	SkipNonFinite NonFinitePolicy = iota
+	// ZeroNonFinite replaces NaN and infinite values with 0.
+	ZeroNonFinite
+	// PropagateNonFinite makes the aggregate NaN if any value is NaN, infinite values are aggregated as is.
+	PropagateNonFinite
+)
+
+// ParseNonFinitePolicy parses "skip", "zero" or "propagate".
+func ParseNonFinitePolicy(s string) (NonFinitePolicy, error) {
+	switch s {
+	case "skip", "":
+		return SkipNonFinite, nil
+	case "zero":
+		return ZeroNonFinite, nil
+	case "propagate":
+		return PropagateNonFinite, nil
+	}
+	return SkipNonFinite, fmt.Errorf("invalid NaN/Inf policy %q, must be one of skip, zero or propagate", s)
+}
+
+// apply returns the values to aggregate under the policy, ok is false if the aggregate is NaN.
+func (p NonFinitePolicy) apply(values []float64) (kept []float64, ok bool) {
+	kept = make([]float64, 0, len(values))
+	for _, v := range values {
+		switch {
+		case isFinite(v):
+			kept = append(kept, v)
+		case p == ZeroNonFinite:
+			kept = append(kept, 0)
+		case p == PropagateNonFinite:
+			if math.IsNaN(v) {
+				return nil, false
+			}
+			kept = append(kept, v)
+		}
+	}
+	return kept, true
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// Aggregator reduces the values of several entities at one timestamp to a single value.
+type Aggregator struct {
+	Name string
+	// Reduce is called with at least one value.
+	Reduce func(values []float64) float64
+	// Raw aggregators receive every value before the NonFinitePolicy is applied, for example to count them.
+	Raw bool
+}
+
+// Built in aggregators, see LookupAggregator for selecting them by name.
+var (
+	AggSum          = Aggregator{Name: "sum", Reduce: sum}
+	AggMean         = Aggregator{Name: "mean", Reduce: mean}
+	AggMin          = Aggregator{Name: "min", Reduce: minimum}
+	AggMax          = Aggregator{Name: "max", Reduce: maximum}
+	AggStdDev       = Aggregator{Name: "stddev", Reduce: stddev}
+	AggCount        = Aggregator{Name: "count", Reduce: count, Raw: true}
+	AggCountNonNull = Aggregator{Name: "count-non-null", Reduce: countFinite, Raw: true}
+	AggP50          = Percentile(50)
+	AggP90          = Percentile(90)
+	AggP99          = Percentile(99)
+)
+
+var aggregators = []Aggregator{AggSum, AggMean, AggMin, AggMax, AggStdDev, AggCount, AggCountNonNull, AggP50, AggP90, AggP99}
+
+// Percentile returns an aggregator for the pth percentile, interpolating linearly between the closest ranks.
+// p is clamped to [0, 100], a NaN p reduces to NaN.
+func Percentile(p float64) Aggregator {
+	return Aggregator{
+		Name: "p" + strconv.FormatFloat(p, 'f', -1, 64),
+		Reduce: func(values []float64) float64 {
+			return percentile(values, p)
+		},
+	}
+}
+
+// LookupAggregator returns the aggregator called name. Besides the built in names any percentile pN with
+// 0 <= N <= 100 is accepted, e.g. p95 or p99.9.
+func LookupAggregator(name string) (Aggregator, error) {
+	for _, a := range aggregators {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	if strings.HasPrefix(name, "p") {
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err == nil && p >= 0 && p <= 100 {
+			return Percentile(p), nil
+		}
+	}
+	return Aggregator{}, fmt.Errorf("unknown aggregator %q, must be one of %s or pN", name, strings.Join(AggregatorNames(), ", "))
+}
+
+// AggregatorNames returns the names of the built in aggregators.
+func AggregatorNames() []string {
+	var names []string
+	for _, a := range aggregators {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+// Aggregate reduces metric across items at each timestamp with agg. Timestamps are truncated to the second.
+func Aggregate(items []openapi.MetricItem, metric string, agg Aggregator, policy NonFinitePolicy) Series {
+	var series Series
+	for _, column := range columns(items, metric) {
+		if v, ok := agg.apply(column.values, policy); ok {
+			series = append(series, Point{Timestamp: column.timestamp, Value: v})
+		}
+	}
+	return series
+}
+
+// Reduce aggregates the values of the series over time, e.g. the maximum of a summed series. It returns
+// false if no values remain after the policy is applied.
+func (s Series) Reduce(agg Aggregator, policy NonFinitePolicy) (float64, bool) {
+	return agg.apply(s.Values(), policy)
+}
+
+// apply reduces values under policy, it returns false if the aggregate should be omitted.
+func (a Aggregator) apply(values []float64, policy NonFinitePolicy) (float64, bool) {
+	if a.Raw {
+		return a.Reduce(values), len(values) > 0
+	}
+	kept, ok := policy.apply(values)
+	if !ok {
+		return math.NaN(), true
+	}
+	if len(kept) == 0 {
+		return 0, false
+	}
+	return a.Reduce(kept), true
+}
+
+func sum(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func mean(values []float64) float64 {
+	return sum(values) / float64(len(values))
+}
+
+func minimum(values []float64) float64 {
+	var m = values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func maximum(values []float64) float64 {
+	var m = values[0]
+	for _, v := range values[1:] {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
+
+// stddev returns the population standard deviation.
+func stddev(values []float64) float64 {
+	var mu = mean(values)
+	var squares float64
+	for _, v := range values {
+		squares += (v - mu) * (v - mu)
+	}
+	return math.Sqrt(squares / float64(len(values)))
+}
+
+func count(values []float64) float64 {
+	return float64(len(values))
+}
+
+func countFinite(values []float64) float64 {
+	var n int
+	for _, v := range values {
+		if isFinite(v) {
+			n++
+		}
+	}
+	return float64(n)
+}
+
+func percentile(values []float64, p float64) float64 {
+	if math.IsNaN(p) {
+		return math.NaN()
+	}
+	var sorted = append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := math.Max(0, math.Min(p/100, 1)) * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
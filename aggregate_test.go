@@ -0,0 +1,152 @@
+package instana_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// column returns one item per value, each with a single point at the same timestamp.
+func column(values ...float64) []openapi.MetricItem {
+	var items []openapi.MetricItem
+	for _, v := range values {
+		items = append(items, openapi.MetricItem{Metrics: cpuUser(1601553600, []float64{v})})
+	}
+	return items
+}
+
+func Test_Aggregate(t *testing.T) {
+	t.Parallel()
+
+	nan := math.NaN()
+	inf := math.Inf(1)
+	values := column(4, 1, 3, 2, 5)
+	nonFinite := column(4, 1, nan, 3, inf)
+
+	td := map[string]struct {
+		items    []openapi.MetricItem
+		agg      string
+		policy   instana.NonFinitePolicy
+		expected []float64
+	}{
+		"sum":                     {values, "sum", instana.SkipNonFinite, []float64{15}},
+		"mean":                    {values, "mean", instana.SkipNonFinite, []float64{3}},
+		"min":                     {values, "min", instana.SkipNonFinite, []float64{1}},
+		"max":                     {values, "max", instana.SkipNonFinite, []float64{5}},
+		"stddev":                  {values, "stddev", instana.SkipNonFinite, []float64{math.Sqrt2}},
+		"p50":                     {values, "p50", instana.SkipNonFinite, []float64{3}},
+		"p90":                     {values, "p90", instana.SkipNonFinite, []float64{4.6}},
+		"p99":                     {values, "p99", instana.SkipNonFinite, []float64{4.96}},
+		"p0":                      {values, "p0", instana.SkipNonFinite, []float64{1}},
+		"p100":                    {values, "p100", instana.SkipNonFinite, []float64{5}},
+		"count":                   {nonFinite, "count", instana.SkipNonFinite, []float64{5}},
+		"count non null":          {nonFinite, "count-non-null", instana.SkipNonFinite, []float64{3}},
+		"skip non finite":         {nonFinite, "max", instana.SkipNonFinite, []float64{4}},
+		"zero non finite":         {nonFinite, "mean", instana.ZeroNonFinite, []float64{1.6}},
+		"propagate NaN":           {nonFinite, "sum", instana.PropagateNonFinite, []float64{nan}},
+		"propagate Inf":           {column(1, inf), "max", instana.PropagateNonFinite, []float64{inf}},
+		"skip only non finite":    {column(nan, inf), "mean", instana.SkipNonFinite, nil},
+		"count only non finite":   {column(nan, inf), "count-non-null", instana.SkipNonFinite, []float64{0}},
+		"single value":            {column(7), "stddev", instana.SkipNonFinite, []float64{0}},
+		"single value percentile": {column(7), "p99", instana.SkipNonFinite, []float64{7}},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			agg, err := instana.LookupAggregator(tc.agg)
+			if err != nil {
+				t.Fatalf("LookupAggregator(%s) error = %v", tc.agg, err)
+			}
+			actual := instana.Aggregate(tc.items, CpuUser, agg, tc.policy)
+			if !cmp.Equal(actual.Values(), tc.expected, cmpopts.EquateNaNs(), cmpopts.EquateApprox(0, 1e-9), cmpopts.EquateEmpty()) {
+				t.Errorf("Aggregate(%s) = %v, want %v", tc.agg, actual.Values(), tc.expected)
+			}
+		})
+	}
+}
+
+func Test_Aggregate_timestamps(t *testing.T) {
+	t.Parallel()
+
+	items := []openapi.MetricItem{
+		{Metrics: cpuUser(1601553600, []float64{1, 2, 3})},
+		{Metrics: cpuUser(1601553601, []float64{5, 6})},
+	}
+	expected := instana.Series{
+		{Timestamp: 1601553600000, Value: 1},
+		{Timestamp: 1601553601000, Value: 5},
+		{Timestamp: 1601553602000, Value: 6},
+	}
+
+	actual := instana.Aggregate(items, CpuUser, instana.AggMax, instana.SkipNonFinite)
+	if !cmp.Equal(actual, expected) {
+		t.Errorf("Aggregate() diff: %v", cmp.Diff(actual, expected))
+	}
+
+	peak, ok := actual.Reduce(instana.AggMax, instana.SkipNonFinite)
+	if !ok || peak != 6 {
+		t.Errorf("Reduce(max) = %v, %v, want 6, true", peak, ok)
+	}
+}
+
+func Test_Percentile_out_of_range(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		p        float64
+		expected float64
+	}{
+		"above 100": {150, 5},
+		"negative":  {-10, 1},
+		"NaN":       {math.NaN(), math.NaN()},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := instana.Aggregate(column(4, 1, 3, 2, 5), CpuUser, instana.Percentile(tc.p), instana.SkipNonFinite)
+			if len(actual) != 1 || !cmp.Equal(actual[0].Value, tc.expected, cmpopts.EquateNaNs()) {
+				t.Errorf("Aggregate(Percentile(%v)) = %v, want %v", tc.p, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func Test_LookupAggregator_invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"median", "p101", "p-1", "px", ""} {
+		_, err := instana.LookupAggregator(name)
+		if err == nil {
+			t.Errorf("LookupAggregator(%q) error = nil, want error", name)
+		}
+	}
+}
+
+func Test_Point_JSON(t *testing.T) {
+	t.Parallel()
+
+	series := instana.Series{{Timestamp: 1000, Value: 0.5}, {Timestamp: 2000, Value: math.NaN()}}
+	b, err := json.Marshal(series)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if string(b) != `[{"timestamp":1000,"value":0.5},{"timestamp":2000,"value":null}]` {
+		t.Errorf("json.Marshal() = %s", b)
+	}
+
+	var decoded instana.Series
+	err = json.Unmarshal(b, &decoded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !cmp.Equal(decoded, series, cmpopts.EquateNaNs()) {
+		t.Errorf("json.Unmarshal() = %v, want %v", decoded, series)
+	}
+}
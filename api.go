@@ -2,15 +2,10 @@ package instana
 
 import (
 	"context"
-	"crypto/tls"
-	"errors"
 	"fmt"
 	"log"
-	"math"
 	"net/http"
 	"net/url"
-	"sort"
-	"strconv"
 	"time"
 
 	"github.com/antihax/optional"
@@ -23,55 +18,111 @@ type InfraQuery interface {
 	ListSnapshots(queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error)
 }
 
+// InfraQueryContext is the context-first variant of InfraQuery. The context is passed through to the
+// underlying HTTP request so callers can cancel a call or bound it with a deadline.
+type InfraQueryContext interface {
+	ListMetricsContext(ctx context.Context, queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error)
+	ListSnapshotsContext(ctx context.Context, queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error)
+}
+
+// ClientOption configures optional behaviour of the client built by NewClient.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	retry   RetryPolicy
+	limiter *RateLimiter
+	tls     TLSOptions
+	proxy   string
+	record  string
+	replay  string
+}
+
+// WithRetryPolicy sets the policy used to retry rate limited and transient failures.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.retry = policy
+	}
+}
+
+// WithRateLimiter shares limiter with the client, allowing several clients using the same token to share a quota.
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(o *clientOptions) {
+		o.limiter = limiter
+	}
+}
+
 // NewClient builds an Instana API client from the specified URL and token.
-func NewClient(apiURL string, apiToken string) (InfraQuery, error) {
-	configuration, err := newConfiguration(apiURL, true)
+func NewClient(apiURL string, apiToken string, opts ...ClientOption) (*InfraQueryAPI, error) {
+	var options = clientOptions{
+		retry: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.limiter == nil {
+		options.limiter = NewRateLimiter(DefaultRateLimitReserve)
+	}
+
+	configuration, err := newConfiguration(apiURL, options)
 	if err != nil {
 		return nil, err
 	}
+	if options.tls.InsecureSkipVerify {
+		log.Println("warning TLS certificate verification is disabled")
+	}
 
 	client := openapi.NewAPIClient(configuration)
-	ctx := context.WithValue(
-		context.Background(),
-		openapi.ContextAPIKey,
-		openapi.APIKey{
+
+	api := &InfraQueryAPI{
+		client:  client,
+		limiter: options.limiter,
+		retry:   options.retry,
+		apiKey: openapi.APIKey{
 			Key:    apiToken,
 			Prefix: "apiToken",
 		},
-	)
-
-	api := &InfraQueryAPI{
-		client: client,
-		ctx:    ctx,
 	}
 
 	return api, nil
 }
 
-// InfraQueryAPI is a concrete implementation fo the InfraQuery interface using the openapi client.
+// InfraQueryAPI is a concrete implementation fo the InfraQuery and InfraQueryContext interfaces using the openapi client.
 type InfraQueryAPI struct {
-	client *openapi.APIClient
-	ctx    context.Context
+	client  *openapi.APIClient
+	limiter *RateLimiter
+	retry   RetryPolicy
+	apiKey  openapi.APIKey
+}
+
+var _ InfraQuery = (*InfraQueryAPI)(nil)
+var _ InfraQueryContext = (*InfraQueryAPI)(nil)
+
+// withAuth attaches the API token to the supplied context.
+func (api *InfraQueryAPI) withAuth(ctx context.Context) context.Context {
+	return context.WithValue(ctx, openapi.ContextAPIKey, api.apiKey)
 }
 
 // ListSnapshots returns the list of snapshots matching the supplied query parameters.
 func (api *InfraQueryAPI) ListSnapshots(queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	return api.ListSnapshotsContext(context.Background(), queryString, pluginType, windowSize)
+}
+
+// ListSnapshotsContext returns the list of snapshots matching the supplied query parameters using ctx for the request.
+func (api *InfraQueryAPI) ListSnapshotsContext(ctx context.Context, queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
 	var snapshotsQuery = &openapi.GetSnapshotsOpts{
 		Query:      optional.NewString(queryString),
 		Plugin:     optional.NewString(pluginType),
 		WindowSize: optional.NewInt64(windowSize),
 	}
-	snapshotResp, httpResp, err := api.client.InfrastructureMetricsApi.GetSnapshots(api.ctx, snapshotsQuery)
+	var snapshotResp openapi.SnapshotResult
+	err := api.call(ctx, "retrieving snapshots", func(ctx context.Context) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		snapshotResp, httpResp, err = api.client.InfrastructureMetricsApi.GetSnapshots(ctx, snapshotsQuery)
+		return httpResp, err
+	})
 	if err != nil {
-		log.Fatalf("error in retrieving snapshots: %s\n", err.(openapi.GenericOpenAPIError).Body())
-	}
-
-	remaining, err := strconv.ParseInt(httpResp.Header.Get("X-Ratelimit-Remaining"), 10, 32)
-	if err != nil {
-		log.Println("unable to convert remaining rate limit")
-	}
-	if remaining < 25 && remaining % 5 == 0 {
-		log.Printf("warning minimal requests remaining: %v\n", remaining)
+		return nil, err
 	}
 
 	return snapshotResp.Items, nil
@@ -79,6 +130,11 @@ func (api *InfraQueryAPI) ListSnapshots(queryString string, pluginType string, w
 
 // ListMetrics returns the list of metrics matching the supplied query parameters.
 func (api *InfraQueryAPI) ListMetrics(queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	return api.ListMetricsContext(context.Background(), queryString, pluginType, metrics, rollup, windowSize, to)
+}
+
+// ListMetricsContext returns the list of metrics matching the supplied query parameters using ctx for the request.
+func (api *InfraQueryAPI) ListMetricsContext(ctx context.Context, queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
 	var query = &openapi.GetInfrastructureMetricsOpts{
 		GetCombinedMetrics: optional.NewInterface(openapi.GetCombinedMetrics{
 			TimeFrame: openapi.TimeFrame{
@@ -92,143 +148,81 @@ func (api *InfraQueryAPI) ListMetrics(queryString string, pluginType string, met
 		}),
 	}
 
-	metricsResp, httpResp, err := api.client.InfrastructureMetricsApi.GetInfrastructureMetrics(api.ctx, query)
+	var metricsResp openapi.InfrastructureMetricResult
+	err := api.call(ctx, "retrieving metrics", func(ctx context.Context) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		metricsResp, httpResp, err = api.client.InfrastructureMetricsApi.GetInfrastructureMetrics(ctx, query)
+		return httpResp, err
+	})
 	if err != nil {
-		gerr, ok := err.(openapi.GenericOpenAPIError)
-		if !ok {
-			return nil, fmt.Errorf("error retrieving metrics: %v", err)
-		}
-		return nil, fmt.Errorf("error in retrieving metrics: %s", gerr.Body())
+		return nil, err
 	}
 
-	remaining, err := strconv.ParseInt(httpResp.Header.Get("X-Ratelimit-Remaining"), 10, 32)
-	if err != nil {
-		log.Println("unable to convert remaining rate limit")
-	}
-	if remaining < 25 && remaining % 5 == 0 {
-		log.Printf("Warning Requests Remaining: %v\n", httpResp.Header.Get("X-Ratelimit-Remaining"))
-	}
 	if len(metricsResp.Items) < 1 {
-		return nil, errors.New("no metrics found")
+		return nil, ErrNoMetrics
 	}
 
 	return metricsResp.Items, nil
 }
 
-// ToInstanaTS converts a datetime string to an instana Dynamic Focus Query timestamp.
+// ToInstanaTS converts a time expression to an instana Dynamic Focus Query timestamp, times without an
+// offset or zone are UTC. See ParseTime for the accepted expressions.
 func ToInstanaTS(datetime string) (int64, error) {
-	if len(datetime) == 10 {
-		datetime += " 00:00:00"
-	}
-
-	t, err := time.Parse("2006-01-02 15:04:05", datetime)
+	t, err := ParseTime(datetime, time.Now(), time.UTC)
 	if err != nil {
 		return -1, err
 	}
-	return t.Unix() * 1000, nil
+	return t.UnixNano() / int64(time.Millisecond), nil
 }
 
-func newConfiguration(apiURL string, isInsecure bool) (*openapi.Configuration, error) {
+func newConfiguration(apiURL string, options clientOptions) (*openapi.Configuration, error) {
 	u, err := url.Parse(apiURL)
 	if err != nil {
 		return nil, err
 	}
 
+	tlsConfig, err := options.tls.config()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if options.proxy != "" {
+		proxyURL, err := url.Parse(options.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	switch {
+	case options.replay != "":
+		roundTripper = &ReplayTransport{Dir: options.replay}
+	case options.record != "":
+		roundTripper = &RecordingTransport{Dir: options.record, Next: transport}
+	}
+
 	httpClient := &http.Client{
-		Transport: &http.Transport{
-			// ignore expired SSL certificates
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: isInsecure},
-		},
+		Transport: roundTripper,
 	}
 
 	configuration := openapi.NewConfiguration()
 	configuration.BasePath = apiURL
-	configuration.Host = u.Hostname()
+	configuration.Host = u.Host
 	configuration.HTTPClient = httpClient
 
 	return configuration, nil
 }
 
-// ParseDuration parses a duration string and scales it to the value expected by the Instana API.
+// ParseDuration parses a duration string and scales it to the value expected by the Instana API. Days
+// and weeks are accepted, see ParseLongDuration.
 func ParseDuration(s string) (int64, error) {
-	duration, err := time.ParseDuration(s)
+	duration, err := ParseLongDuration(s)
 	if err != nil {
 		return -1, err
 	}
 	return int64(duration / time.Millisecond), nil
 }
-
-const percentBuckets = 21
-
-type PercentageHeatmap map[string][percentBuckets]int
-
-const hoursMinutesSeconds = "15:04:05"
-
-func Sum(items []openapi.MetricItem, metric string) []float64 {
-	series := make(map[string]float64)
-	for _, item := range items {
-		ts := item.Metrics[metric]
-		for _, m := range ts {
-			t := time.Unix(int64(m[0]/1000), 0).UTC().Format(hoursMinutesSeconds)
-			v := series[t]
-			v += m[1]
-			series[t] = v
-		}
-	}
-	var keys []string
-	for k := range series {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	var ts []float64
-	for _, k := range keys {
-		ts = append(ts, series[k])
-	}
-	return ts
-}
-
-func ToPercentageHeatmap(items []openapi.MetricItem, metric string) PercentageHeatmap {
-	var ph = make(PercentageHeatmap)
-	for _, item := range items {
-		ts := item.Metrics[metric]
-		for _, m := range ts {
-			t := time.Unix(int64(m[0]/1000), 0).UTC().Format(hoursMinutesSeconds)
-			v := int(math.Floor(m[1] * percentBuckets)) // scale to an index
-			if v == 0 && m[1] > 0 {
-				v = 1
-			}
-			if v > percentBuckets - 1 {
-				v = percentBuckets - 1
-			}
-			hist, ok := ph[t]
-			if !ok {
-				hist = [percentBuckets]int{}
-			}
-			hist[v]++
-			ph[t] = hist
-		}
-	}
-	return ph
-}
-
-func ToTabular(hist PercentageHeatmap) [][]string {
-	var tab = [][]string{{"group","variable","value"}}
-	var labels []string
-	for l := range hist {
-		labels = append(labels, l)
-	}
-	sort.Strings(labels)
-	for _, l := range labels {
-		for i, v := range hist[l] {
-			var p string
-			if i == 0 {
-				p = "0%"
-			} else {
-				p = fmt.Sprintf("%d%%", i * 100 / (percentBuckets -1))
-			}
-			s := fmt.Sprintf("%d", v)
-			tab = append(tab, []string{l, p, s})
-		}
-	}
-	return tab
-}
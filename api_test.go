@@ -1,7 +1,12 @@
 package instana_test
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/nfisher/instana-crib"
@@ -20,6 +25,8 @@ func Test_ToInstanaTS(t *testing.T) {
 		{"valid date time", "2020-04-06 00:00:01", 1586131201 * 1000, false},
 		{"default time to midnight", "2020-04-06", 1586131200 * 1000, false},
 		{"invalid", "adbdcadsca1234", -1, true},
+		{"RFC3339 with offset", "2020-04-06T02:00:01+02:00", 1586131201 * 1000, false},
+		{"epoch milliseconds", "1586131201000", 1586131201 * 1000, false},
 	}
 
 	for _, tc := range td {
@@ -48,6 +55,9 @@ func Test_InstanaDuration(t *testing.T) {
 		{"secound", "1s", 1000, false},
 		{"minute", "1m", 60 * 1000, false},
 		{"hour", "1h", 60 * 60 * 1000, false},
+		{"day", "1d", 24 * 60 * 60 * 1000, false},
+		{"week and days", "1w2d", 9 * 24 * 60 * 60 * 1000, false},
+		{"invalid unit", "1y", -1, true},
 	}
 
 	for _, tc := range td {
@@ -83,7 +93,7 @@ func Test_Sum_aligns_seconds(t *testing.T) {
 		{Metrics: cpuUser(1601553600, []float64{0.01, 0.01, 0.01})},
 		{Metrics: cpuUser(1601553601, []float64{0.01, 0.02})},
 	}
-	expected := []float64{0.01, 0.02, 0.03}
+	expected := instana.Series{{Timestamp: 1601553600000, Value: 0.01}, {Timestamp: 1601553601000, Value: 0.02}, {Timestamp: 1601553602000, Value: 0.03}}
 
 	actual := instana.Sum(input, CpuUser)
 
@@ -101,15 +111,15 @@ func Test_ToPercentageHeatmap(t *testing.T) {
 	}{
 		"multiple moments": {
 			[]openapi.MetricItem{{Metrics: cpuUser(1601553600, []float64{0, 0.01, 0.1})}},
-			instana.PercentageHeatmap{"12:00:00": [percentBucketSize]int{1}, "12:00:01": [percentBucketSize]int{0, 1}, "12:00:02": [percentBucketSize]int{0, 0, 1}}},
+			instana.PercentageHeatmap{1601553600000: [percentBucketSize]int{1}, 1601553601000: [percentBucketSize]int{0, 1}, 1601553602000: [percentBucketSize]int{0, 0, 1}}},
 		"multiple items": {
 			[]openapi.MetricItem{
 				{Metrics: cpuUser(1601553600, []float64{0.01, 0.01, 0.01})},
 				{Metrics: cpuUser(1601553600, []float64{0.1, 0.01, 1.0})}},
 			instana.PercentageHeatmap{
-				"12:00:00": [percentBucketSize]int{0, 1, 1},
-				"12:00:01": [percentBucketSize]int{0, 2},
-				"12:00:02": [percentBucketSize]int{0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}}},
+				1601553600000: [percentBucketSize]int{0, 1, 1},
+				1601553601000: [percentBucketSize]int{0, 2},
+				1601553602000: [percentBucketSize]int{0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}}},
 	}
 
 	for name, tc := range td {
@@ -123,8 +133,8 @@ func Test_ToPercentageHeatmap(t *testing.T) {
 }
 
 func Test_ToTabular(t *testing.T) {
-	hist := instana.PercentageHeatmap{"12:00:00": [percentBucketSize]int{1, 1}, "12:00:01": [percentBucketSize]int{2}, "12:00:02": [percentBucketSize]int{1, 0,  0,  0,  0,  0,  0,  0,  0, 1}}
-	tab := instana.ToTabular(hist)
+	hist := instana.PercentageHeatmap{1601553600000: [percentBucketSize]int{1, 1}, 1601553601000: [percentBucketSize]int{2}, 1601553602000: [percentBucketSize]int{1, 0,  0,  0,  0,  0,  0,  0,  0, 1}}
+	tab := instana.ToTabular(hist.Heatmap())
 	expected := [][]string{
 		{"group","variable","value"},
 		{"12:00:00", "0%", "1"},
@@ -154,3 +164,35 @@ func Test_ToTabular(t *testing.T) {
 		t.Errorf("-got/+want:\n%s", cmp.Diff(expected, tab[:22]))
 	}
 }
+
+func Test_ListMetricsContext_deadline(t *testing.T) {
+	t.Parallel()
+
+	const delay = 5 * time.Second
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(delay):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	api, err := instana.NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = api.ListMetricsContext(ctx, "entity.zone:test", "host", []string{CpuUser}, 1, 60000, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ListMetricsContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed >= delay/2 {
+		t.Errorf("ListMetricsContext() returned after %v, want well before the server's %v delay", elapsed, delay)
+	}
+}
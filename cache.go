@@ -0,0 +1,219 @@
+package instana
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// CacheSettleTime is how long after a window ends it is still cached with a TTL rather than permanently,
+// allowing late data to arrive.
+const CacheSettleTime = 10 * time.Minute
+
+// Cache is an InfraQueryContext decorator that stores query results on disk. Metric windows that ended
+// more than CacheSettleTime ago never expire, windows that end more recently expire after the TTL and
+// windows that end within a rollup of the present are never cached, their last point is still changing.
+// Snapshot lists are relative to the present so they always expire after the TTL. Expired entries are
+// deleted when read and the directory is pruned of them on the first write.
+type Cache struct {
+	next      InfraQueryContext
+	dir       string
+	namespace string
+	ttl       time.Duration
+	pruneOnce sync.Once
+}
+
+var _ InfraQuery = (*Cache)(nil)
+var _ InfraQueryContext = (*Cache)(nil)
+
+// NewCache builds a cache in dir in front of next. The namespace identifies the Instana unit so several
+// units can share a cache directory.
+func NewCache(next InfraQueryContext, dir string, namespace string, ttl time.Duration) *Cache {
+	return &Cache{
+		next:      next,
+		dir:       dir,
+		namespace: namespace,
+		ttl:       ttl,
+	}
+}
+
+// DefaultCacheDir returns the default cache location, normally ~/.cache/instana-crib.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "instana-crib"), nil
+}
+
+type cacheKey struct {
+	Namespace  string   `json:"namespace"`
+	Kind       string   `json:"kind"`
+	Query      string   `json:"query"`
+	Plugin     string   `json:"plugin"`
+	Metrics    []string `json:"metrics,omitempty"`
+	Rollup     int64    `json:"rollup,omitempty"`
+	WindowSize int64    `json:"windowSize"`
+	To         int64    `json:"to,omitempty"`
+}
+
+type cacheEntry struct {
+	// Expires is the expiry time in ms, 0 never expires.
+	Expires   int64                  `json:"expires,omitempty"`
+	Metrics   []openapi.MetricItem   `json:"metrics,omitempty"`
+	Snapshots []openapi.SnapshotItem `json:"snapshots,omitempty"`
+}
+
+// ListMetrics returns the cached metrics or retrieves them from the next client.
+func (c *Cache) ListMetrics(queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	return c.ListMetricsContext(context.Background(), queryString, pluginType, metrics, rollup, windowSize, to)
+}
+
+// ListMetricsContext returns the cached metrics or retrieves them from the next client.
+func (c *Cache) ListMetricsContext(ctx context.Context, queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	now := time.Now()
+	var expires int64
+	switch {
+	case to <= 0 || to > toMillis(now)-rollup*1000:
+		return c.next.ListMetricsContext(ctx, queryString, pluginType, metrics, rollup, windowSize, to)
+	case to >= toMillis(now.Add(-CacheSettleTime)):
+		expires = toMillis(now.Add(c.ttl))
+	}
+
+	path := c.path(cacheKey{
+		Kind:       "metrics",
+		Query:      queryString,
+		Plugin:     pluginType,
+		Metrics:    metrics,
+		Rollup:     rollup,
+		WindowSize: windowSize,
+		To:         to,
+	})
+	if entry, ok := c.read(path, now); ok {
+		return entry.Metrics, nil
+	}
+
+	items, err := c.next.ListMetricsContext(ctx, queryString, pluginType, metrics, rollup, windowSize, to)
+	if err != nil {
+		return items, err
+	}
+	c.write(path, cacheEntry{Expires: expires, Metrics: items})
+
+	return items, nil
+}
+
+// ListSnapshots returns the cached snapshots or retrieves them from the next client.
+func (c *Cache) ListSnapshots(queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	return c.ListSnapshotsContext(context.Background(), queryString, pluginType, windowSize)
+}
+
+// ListSnapshotsContext returns the cached snapshots or retrieves them from the next client.
+func (c *Cache) ListSnapshotsContext(ctx context.Context, queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	now := time.Now()
+	path := c.path(cacheKey{
+		Kind:       "snapshots",
+		Query:      queryString,
+		Plugin:     pluginType,
+		WindowSize: windowSize,
+	})
+	if entry, ok := c.read(path, now); ok {
+		return entry.Snapshots, nil
+	}
+
+	items, err := c.next.ListSnapshotsContext(ctx, queryString, pluginType, windowSize)
+	if err != nil {
+		return items, err
+	}
+	c.write(path, cacheEntry{Expires: toMillis(now.Add(c.ttl)), Snapshots: items})
+
+	return items, nil
+}
+
+func (c *Cache) path(key cacheKey) string {
+	key.Namespace = c.namespace
+	b, _ := json.Marshal(key)
+	sum := sha256.Sum256(b)
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// read returns the entry at path if it exists and has not expired, expired entries are deleted.
+func (c *Cache) read(path string, now time.Time) (cacheEntry, bool) {
+	var entry cacheEntry
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return entry, false
+	}
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		log.Printf("ignoring corrupt cache entry %s: %v\n", path, err)
+		return entry, false
+	}
+	if entry.Expires != 0 && entry.Expires <= toMillis(now) {
+		os.Remove(path)
+		return entry, false
+	}
+	return entry, true
+}
+
+// prune deletes the expired entries in the cache directory. Most expiring entries are never read again
+// as their key includes the end of the window.
+func (c *Cache) prune(now time.Time) {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		log.Printf("unable to prune cache dir: %v\n", err)
+		return
+	}
+	for _, fi := range files {
+		if fi.Mode().IsRegular() && filepath.Ext(fi.Name()) == ".json" {
+			c.read(filepath.Join(c.dir, fi.Name()), now)
+		}
+	}
+}
+
+// write stores entry at path. Failures are logged as the cache is only an optimisation.
+func (c *Cache) write(path string, entry cacheEntry) {
+	err := os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		log.Printf("unable to create cache dir: %v\n", err)
+		return
+	}
+	c.pruneOnce.Do(func() { c.prune(time.Now()) })
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("unable to encode cache entry: %v\n", err)
+		return
+	}
+
+	// write to a temporary file and rename so concurrent readers never see a partial entry.
+	f, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		log.Printf("unable to write cache entry: %v\n", err)
+		return
+	}
+	_, err = f.Write(b)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		log.Printf("unable to write cache entry: %v\n", err)
+	}
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
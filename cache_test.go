@@ -0,0 +1,116 @@
+package instana_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_Cache_ListMetricsContext(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	td := map[string]struct {
+		to    int64
+		ttl   time.Duration
+		calls int
+	}{
+		"window in the past is cached":         {now - 24*3600*1000, time.Nanosecond, 1},
+		"recent window is cached for the ttl":  {now - 60*1000, time.Hour, 1},
+		"recent window expires after the ttl":  {now - 60*1000, time.Nanosecond, 2},
+		"window reaching now is not cached":    {now + 60*1000, time.Hour, 2},
+		"window within a rollup is not cached": {now - 500, time.Hour, 2},
+		"window relative to now is not cached": {0, time.Hour, 2},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			next := &pointsPerWindow{snapshots: []string{"a"}}
+			cache := instana.NewCache(next, t.TempDir(), "test", tc.ttl)
+
+			for i := 0; i < 2; i++ {
+				items, err := cache.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{CpuUser}, 1, 60000, tc.to)
+				if err != nil {
+					t.Fatalf("ListMetricsContext() error = %v", err)
+				}
+				if len(items) != 1 || len(items[0].Metrics[CpuUser]) != 61 {
+					t.Fatalf("ListMetricsContext() = %v items, want 1 item with 61 points", len(items))
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			if len(next.calls) != tc.calls {
+				t.Errorf("calls = %v, want %v", len(next.calls), tc.calls)
+			}
+		})
+	}
+}
+
+func Test_Cache_prunes_expired_entries(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	next := &pointsPerWindow{snapshots: []string{"a"}}
+	expiring := instana.NewCache(next, dir, "test", time.Nanosecond)
+	for _, to := range []int64{now - 60*1000, now - 120*1000, now - 24*3600*1000} {
+		_, err := expiring.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{CpuUser}, 1, 60000, to)
+		if err != nil {
+			t.Fatalf("ListMetricsContext() error = %v", err)
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	cache := instana.NewCache(next, dir, "test", time.Hour)
+	_, err := cache.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{CpuUser}, 1, 60000, now-180*1000)
+	if err != nil {
+		t.Fatalf("ListMetricsContext() error = %v", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("cache entries = %v, want 2", len(files))
+	}
+}
+
+func Test_Cache_keys(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	to := time.Now().Add(-24*time.Hour).UnixNano() / int64(time.Millisecond)
+	next := &pointsPerWindow{snapshots: []string{"a"}}
+	eu := instana.NewCache(next, dir, "eu", time.Hour)
+	us := instana.NewCache(next, dir, "us", time.Hour)
+
+	calls := []struct {
+		cache  *instana.Cache
+		metric string
+		rollup int64
+	}{
+		{eu, CpuUser, 1},
+		{eu, CpuUser, 1},
+		{eu, "cpu.sys", 1},
+		{eu, CpuUser, 5},
+		{us, CpuUser, 1},
+	}
+	for _, c := range calls {
+		_, err := c.cache.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{c.metric}, c.rollup, 60000, to)
+		if err != nil {
+			t.Fatalf("ListMetricsContext() error = %v", err)
+		}
+	}
+
+	if len(next.calls) != 4 {
+		t.Errorf("calls = %v, want 4", len(next.calls))
+	}
+}
@@ -0,0 +1,227 @@
+package instana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// InfraCatalog discovers the plugins, metrics and search fields available in an Instana unit.
+type InfraCatalog interface {
+	ListPluginsContext(ctx context.Context) ([]openapi.PluginResult, error)
+	ListCatalogMetricsContext(ctx context.Context, plugin string) ([]openapi.MetricInstance, error)
+	ListSearchFieldsContext(ctx context.Context) ([]openapi.SearchFieldResult, error)
+}
+
+var _ InfraCatalog = (*InfraQueryAPI)(nil)
+
+// ListPluginsContext returns the plugins available in the unit.
+func (api *InfraQueryAPI) ListPluginsContext(ctx context.Context) ([]openapi.PluginResult, error) {
+	var plugins []openapi.PluginResult
+	err := api.call(ctx, "retrieving catalog plugins", func(ctx context.Context) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		plugins, httpResp, err = api.client.InfrastructureCatalogApi.GetInfrastructureCatalogPlugins(ctx)
+		return httpResp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plugins, nil
+}
+
+// ListCatalogMetricsContext returns the metrics available for plugin.
+func (api *InfraQueryAPI) ListCatalogMetricsContext(ctx context.Context, plugin string) ([]openapi.MetricInstance, error) {
+	var metrics []openapi.MetricInstance
+	err := api.call(ctx, "retrieving catalog metrics", func(ctx context.Context) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		metrics, httpResp, err = api.client.InfrastructureCatalogApi.GetInfrastructureCatalogMetrics(ctx, plugin, nil)
+		return httpResp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// ListSearchFieldsContext returns the keywords that can be used in Dynamic Focus queries.
+func (api *InfraQueryAPI) ListSearchFieldsContext(ctx context.Context) ([]openapi.SearchFieldResult, error) {
+	var fields []openapi.SearchFieldResult
+	err := api.call(ctx, "retrieving catalog search fields", func(ctx context.Context) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		fields, httpResp, err = api.client.InfrastructureCatalogApi.GetInfrastructureCatalogSearchFields(ctx)
+		return httpResp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// CatalogCache is an InfraCatalog decorator that keeps successful results for the lifetime of the process.
+// The catalog only changes when plugins or custom metrics are added to the unit. It is safe for concurrent use.
+type CatalogCache struct {
+	next InfraCatalog
+
+	mu      sync.Mutex
+	plugins []openapi.PluginResult
+	metrics map[string][]openapi.MetricInstance
+	fields  []openapi.SearchFieldResult
+}
+
+var _ InfraCatalog = (*CatalogCache)(nil)
+
+// NewCatalogCache builds a cache in front of next.
+func NewCatalogCache(next InfraCatalog) *CatalogCache {
+	return &CatalogCache{
+		next:    next,
+		metrics: make(map[string][]openapi.MetricInstance),
+	}
+}
+
+// ListPluginsContext returns the cached plugins or retrieves them from the next catalog.
+func (c *CatalogCache) ListPluginsContext(ctx context.Context) ([]openapi.PluginResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.plugins == nil {
+		plugins, err := c.next.ListPluginsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.plugins = plugins
+	}
+	return c.plugins, nil
+}
+
+// ListCatalogMetricsContext returns the cached metrics for plugin or retrieves them from the next catalog.
+func (c *CatalogCache) ListCatalogMetricsContext(ctx context.Context, plugin string) ([]openapi.MetricInstance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics, ok := c.metrics[plugin]
+	if !ok {
+		var err error
+		metrics, err = c.next.ListCatalogMetricsContext(ctx, plugin)
+		if err != nil {
+			return nil, err
+		}
+		c.metrics[plugin] = metrics
+	}
+	return metrics, nil
+}
+
+// ListSearchFieldsContext returns the cached search fields or retrieves them from the next catalog.
+func (c *CatalogCache) ListSearchFieldsContext(ctx context.Context) ([]openapi.SearchFieldResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fields == nil {
+		fields, err := c.next.ListSearchFieldsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.fields = fields
+	}
+	return c.fields, nil
+}
+
+// ValidatePlugin returns an error wrapping ErrInvalidQuery if plugin is not in the catalog.
+func ValidatePlugin(ctx context.Context, catalog InfraCatalog, plugin string) error {
+	plugins, err := catalog.ListPluginsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, p := range plugins {
+		if p.Plugin == plugin {
+			return nil
+		}
+		names = append(names, p.Plugin)
+	}
+	return unknownName("plugin", plugin, names)
+}
+
+// ValidateMetrics returns an error wrapping ErrInvalidQuery if plugin or any of metrics are not in the catalog.
+func ValidateMetrics(ctx context.Context, catalog InfraCatalog, plugin string, metrics []string) error {
+	err := ValidatePlugin(ctx, catalog, plugin)
+	if err != nil {
+		return err
+	}
+
+	available, err := catalog.ListCatalogMetricsContext(ctx, plugin)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	var known = make(map[string]bool, len(available))
+	for _, m := range available {
+		names = append(names, m.MetricId)
+		known[m.MetricId] = true
+	}
+	for _, metric := range metrics {
+		if !known[metric] {
+			return unknownName(plugin+" metric", metric, names)
+		}
+	}
+	return nil
+}
+
+// unknownName describes an unknown name suggesting the closest candidate when it is likely a typo.
+func unknownName(kind string, name string, candidates []string) error {
+	var closest string
+	var best = len(name)/3 + 2
+	for _, c := range candidates {
+		d := editDistance(name, c)
+		if d < best {
+			best = d
+			closest = c
+		}
+	}
+
+	if closest != "" {
+		return fmt.Errorf("%w: unknown %s %q, did you mean %q?", ErrInvalidQuery, kind, name, closest)
+	}
+	return fmt.Errorf("%w: unknown %s %q", ErrInvalidQuery, kind, name)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,120 @@
+package instana_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/instanatest"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+func catalogFake() *instanatest.Fake {
+	return instanatest.NewFake(instanatest.Snapshot{
+		SnapshotItem: openapi.SnapshotItem{SnapshotId: "a", Plugin: "host"},
+		Metrics: map[string]instanatest.Generator{
+			CpuUser:   instanatest.Constant(0.5),
+			"cpu.sys": instanatest.Constant(0.1),
+		},
+	})
+}
+
+func Test_CatalogCache(t *testing.T) {
+	t.Parallel()
+
+	fake := catalogFake()
+	fake.FailNext(errors.New("unavailable"))
+	cache := instana.NewCatalogCache(fake)
+
+	_, err := cache.ListPluginsContext(context.Background())
+	if err == nil {
+		t.Fatal("ListPluginsContext() error = nil, want unavailable")
+	}
+	for i := 0; i < 2; i++ {
+		plugins, err := cache.ListPluginsContext(context.Background())
+		if err != nil {
+			t.Fatalf("ListPluginsContext() error = %v", err)
+		}
+		if len(plugins) != 1 {
+			t.Errorf("len(plugins) = %v, want 1", len(plugins))
+		}
+		_, err = cache.ListCatalogMetricsContext(context.Background(), "host")
+		if err != nil {
+			t.Fatalf("ListCatalogMetricsContext() error = %v", err)
+		}
+	}
+
+	if len(fake.Calls()) != 3 {
+		t.Errorf("calls = %v, want 3", len(fake.Calls()))
+	}
+}
+
+func Test_ValidateMetrics(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		plugin  string
+		metrics []string
+		message string
+	}{
+		"valid":                  {"host", []string{CpuUser, "cpu.sys"}, ""},
+		"plugin typo":            {"hots", []string{CpuUser}, `unknown plugin "hots", did you mean "host"?`},
+		"metric typo":            {"host", []string{"cpu.usr"}, `unknown host metric "cpu.usr", did you mean "cpu.user"?`},
+		"metric without a match": {"host", []string{"memory.used"}, `unknown host metric "memory.used"`},
+	}
+
+	catalog := instana.NewCatalogCache(catalogFake())
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			err := instana.ValidateMetrics(context.Background(), catalog, tc.plugin, tc.metrics)
+			if tc.message == "" {
+				if err != nil {
+					t.Errorf("ValidateMetrics() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, instana.ErrInvalidQuery) {
+				t.Errorf("ValidateMetrics() error = %v, want %v", err, instana.ErrInvalidQuery)
+			}
+			if err != nil && !strings.HasSuffix(err.Error(), tc.message) {
+				t.Errorf("ValidateMetrics() error = %q, want suffix %q", err, tc.message)
+			}
+		})
+	}
+}
+
+func Test_InfraQueryAPI_catalog(t *testing.T) {
+	t.Parallel()
+
+	fixtures, err := instanatest.LoadFixtures("instanatest/testdata/fixtures.json")
+	if err != nil {
+		t.Fatalf("LoadFixtures() error = %v", err)
+	}
+	srv, _ := instanatest.NewServer("token", fixtures)
+	defer srv.Close()
+
+	api, err := instana.NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	plugins, err := api.ListPluginsContext(context.Background())
+	if err != nil || len(plugins) != len(fixtures.Plugins) {
+		t.Errorf("ListPluginsContext() = %v, %v, want %v plugins", len(plugins), err, len(fixtures.Plugins))
+	}
+	metrics, err := api.ListCatalogMetricsContext(context.Background(), "host")
+	if err != nil || len(metrics) != len(fixtures.CatalogMetrics["host"]) {
+		t.Errorf("ListCatalogMetricsContext() = %v, %v, want %v metrics", len(metrics), err, len(fixtures.CatalogMetrics["host"]))
+	}
+	fields, err := api.ListSearchFieldsContext(context.Background())
+	if err != nil || len(fields) != len(fixtures.SearchFields) {
+		t.Errorf("ListSearchFieldsContext() = %v, %v, want %v fields", len(fields), err, len(fixtures.SearchFields))
+	}
+
+	_, err = api.ListCatalogMetricsContext(context.Background(), "jvm")
+	if !errors.Is(err, instana.ErrNotFound) {
+		t.Errorf("ListCatalogMetricsContext(jvm) error = %v, want %v", err, instana.ErrNotFound)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nfisher/instana-crib/instanatest"
+)
+
+func main() {
+	var addr string
+	var fixturesPath string
+	var token string
+	var rateLimit int
+	var failRate float64
+	var failStatus int
+	var delay time.Duration
+
+	flag.StringVar(&addr, "addr", ":8001", "address to listen on")
+	flag.StringVar(&fixturesPath, "fixtures", "instanatest/testdata/fixtures.json", "JSON fixtures to serve")
+	flag.StringVar(&token, "token", "fake-token", "API token clients must supply")
+	flag.IntVar(&rateLimit, "rate-limit", instanatest.DefaultRateLimit, "calls allowed per hour before responding 429")
+	flag.Float64Var(&failRate, "fail-rate", 0, "fraction of requests to fail with -fail-status")
+	flag.IntVar(&failStatus, "fail-status", http.StatusInternalServerError, "status returned by failed requests")
+	flag.DurationVar(&delay, "delay", 0, "delay added to every response")
+
+	flag.Parse()
+
+	fixtures, err := instanatest.LoadFixtures(fixturesPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	h := instanatest.NewHandler(token, fixtures)
+	h.RateLimit = rateLimit
+	h.FailRate = failRate
+	h.FailStatus = failStatus
+	h.Delay = delay
+
+	srv := &http.Server{Addr: addr, Handler: h}
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+		log.Println("shutting down")
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), delay+5*time.Second)
+		defer shutdownCancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("error shutting down server: %v\n", err)
+		}
+	}()
+
+	log.Printf("serving %d snapshots from %s on %s\n", len(fixtures.Snapshots), fixturesPath, addr)
+	err = srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/internal/cli"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// subcommands are the catalog browsing and query checking modes, infraq charts a metric when none is given.
+var subcommands = map[string]func(args []string, out io.Writer) error{
+	"plugins":       runPlugins,
+	"metrics":       runMetrics,
+	"search-fields": runSearchFields,
+	"snapshots":     runSnapshots,
+	"lint-query":    runLintQuery,
+	"topology":      runTopology,
+}
+
+func subcommandNames() []string {
+	var names []string
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// subcommand holds the flags shared by the catalog browsing subcommands.
+type subcommand struct {
+	fs      *flag.FlagSet
+	client  cli.ClientFlags
+	json    bool
+	timeout time.Duration
+}
+
+func newSubcommand(name string) *subcommand {
+	s := &subcommand{fs: flag.NewFlagSet("infraq "+name, flag.ExitOnError)}
+	s.fs.BoolVar(&s.json, "json", false, "print JSON instead of a table")
+	s.fs.DurationVar(&s.timeout, "timeout", 30*time.Second, "maximum time to wait for the Instana API before giving up")
+	s.client.Register(s.fs)
+	return s
+}
+
+// parse parses args and resolves the client profile, the returned context must be cancelled by the caller.
+func (s *subcommand) parse(args []string) (context.Context, context.CancelFunc, error) {
+	err := s.fs.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.fs.NArg() > 0 {
+		return nil, nil, fmt.Errorf("unexpected arguments %v", s.fs.Args())
+	}
+
+	err = s.client.Resolve(s.fs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	go cancelOnSignal(cancel)
+	return ctx, cancel, nil
+}
+
+// print writes v as JSON or writes the rows as a tab aligned table.
+func (s *subcommand) print(out io.Writer, v interface{}, header []string, rows [][]string) error {
+	if s.json {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func runPlugins(args []string, out io.Writer) error {
+	s := newSubcommand("plugins")
+	ctx, cancel, err := s.parse(args)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	catalog, err := s.client.NewCatalog()
+	if err != nil {
+		return err
+	}
+	plugins, err := catalog.ListPluginsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Plugin < plugins[j].Plugin })
+	var rows [][]string
+	for _, p := range plugins {
+		rows = append(rows, []string{p.Plugin, p.Label})
+	}
+	return s.print(out, plugins, []string{"PLUGIN", "LABEL"}, rows)
+}
+
+func runMetrics(args []string, out io.Writer) error {
+	var plugin string
+	var filter string
+	s := newSubcommand("metrics")
+	s.fs.StringVar(&plugin, "plugin", "", "plugin to list the metrics of (e.g. host)")
+	s.fs.StringVar(&filter, "filter", "", "only list metrics whose ID or label contains this text")
+	ctx, cancel, err := s.parse(args)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if plugin == "" {
+		return errors.New("-plugin is required")
+	}
+
+	catalog, err := s.client.NewCatalog()
+	if err != nil {
+		return err
+	}
+	err = instana.ValidatePlugin(ctx, catalog, plugin)
+	if err != nil {
+		return err
+	}
+	metrics, err := catalog.ListCatalogMetricsContext(ctx, plugin)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].MetricId < metrics[j].MetricId })
+	var matched = []openapi.MetricInstance{}
+	var rows [][]string
+	for _, m := range metrics {
+		text := strings.ToLower(m.MetricId + " " + m.Label)
+		if !strings.Contains(text, strings.ToLower(filter)) {
+			continue
+		}
+		matched = append(matched, m)
+
+		custom := ""
+		if m.Custom {
+			custom = "yes"
+		}
+		rows = append(rows, []string{m.MetricId, m.Label, m.Formatter, custom, m.Description})
+	}
+	return s.print(out, matched, []string{"METRIC", "LABEL", "FORMATTER", "CUSTOM", "DESCRIPTION"}, rows)
+}
+
+func runSearchFields(args []string, out io.Writer) error {
+	s := newSubcommand("search-fields")
+	ctx, cancel, err := s.parse(args)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	catalog, err := s.client.NewCatalog()
+	if err != nil {
+		return err
+	}
+	fields, err := catalog.ListSearchFieldsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Keyword < fields[j].Keyword })
+	var rows [][]string
+	for _, f := range fields {
+		rows = append(rows, []string{f.Keyword, f.Context, f.TermType, strings.Join(f.FixedValues, ","), f.Description})
+	}
+	return s.print(out, fields, []string{"KEYWORD", "CONTEXT", "TYPE", "VALUES", "DESCRIPTION"}, rows)
+}
+
+func runSnapshots(args []string, out io.Writer) error {
+	var queryString string
+	var plugin string
+	var windowString string
+	s := newSubcommand("snapshots")
+	s.fs.StringVar(&queryString, "query", "", "Infrastructure query selecting the snapshots, defaults to the profile's query")
+	s.fs.StringVar(&plugin, "plugin", "host", "Snapshot plugin type (e.g. host)")
+	s.fs.StringVar(&windowString, "window", "1h", `window the snapshots were online in (valid time units are "s", "m", "h", "d", "w")`)
+	ctx, cancel, err := s.parse(args)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if queryString == "" {
+		queryString = s.client.Query
+	}
+
+	windowSize, err := instana.ParseDuration(windowString)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.client.NewQuery()
+	if err != nil {
+		return err
+	}
+	snapshots, err := api.ListSnapshotsContext(ctx, queryString, plugin, windowSize)
+	var partial *instana.PartialError
+	if errors.As(err, &partial) && !partial.Complete() {
+		fmt.Fprintf(os.Stderr, "warning %v\n", err)
+	} else if err != nil {
+		return err
+	}
+	if snapshots == nil {
+		snapshots = []openapi.SnapshotItem{}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Label < snapshots[j].Label })
+	var rows [][]string
+	for _, item := range snapshots {
+		rows = append(rows, []string{item.SnapshotId, item.Plugin, item.Label, item.Host, strings.Join(item.Tags, ",")})
+	}
+	return s.print(out, snapshots, []string{"SNAPSHOT", "PLUGIN", "LABEL", "HOST", "TAGS"}, rows)
+}
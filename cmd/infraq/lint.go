@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nfisher/instana-crib"
+)
+
+// errLintFailed is returned when the query has error severity issues so infraq exits non-zero.
+var errLintFailed = errors.New("query has errors")
+
+func runLintQuery(args []string, out io.Writer) error {
+	var queryString string
+	s := newSubcommand("lint-query")
+	s.fs.StringVar(&queryString, "query", "", "Infrastructure query to check, defaults to the profile's query")
+	ctx, cancel, err := s.parse(args)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if queryString == "" {
+		queryString = s.client.Query
+	}
+
+	catalog, err := s.client.NewCatalog()
+	if err != nil {
+		return err
+	}
+	issues, err := instana.LintQuery(ctx, catalog, queryString)
+	if err != nil {
+		return err
+	}
+
+	if s.json {
+		if issues == nil {
+			issues = []instana.LintIssue{}
+		}
+		err = s.print(out, issues, nil, nil)
+	} else {
+		printIssues(out, queryString, issues)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		if issue.Severity == instana.SeverityError {
+			return errLintFailed
+		}
+	}
+	return nil
+}
+
+// printIssues writes the query followed by a caret under the position of each issue.
+func printIssues(out io.Writer, query string, issues []instana.LintIssue) {
+	if len(issues) == 0 {
+		fmt.Fprintln(out, "ok")
+		return
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(out, "%s\n%s^\n%v\n\n", query, strings.Repeat(" ", issue.Pos), issue)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,11 +10,13 @@ import (
 	"log"
 	"math"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/nfisher/instana-crib"
-	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+	"github.com/nfisher/instana-crib/internal/cli"
 	"github.com/wcharczuk/go-chart"
 )
 
@@ -24,22 +27,47 @@ const (
 	SeriesValue = 1
 )
 
-// Exec is the main execution loop of the application.
-func Exec(apiToken string, apiURL string, metricName string, pluginType string, queryString string, rollup int64, to int64, windowSize int64) {
-	var api instana.InfraQuery
-	api, err := instana.NewClient(apiURL, apiToken)
-	if err != nil {
-		log.Fatalf("unable to create client: %v\n", err)
+// Exec is the main execution loop of the application. If details is not nil the charts are titled with
+// snapshot properties, cores additionally scales the metric by the CPU count of each host. A non-nil
+// transform is applied to the metric before charting, e.g. to chart the rate of a counter. A non-nil groupBy
+// charts the agg of each group instead of each item.
+func Exec(ctx context.Context, api instana.InfraQueryContext, details instana.SnapshotGetter, cores bool, transform instana.Transform, groupBy instana.GroupKey, agg instana.Aggregator, metricName string, pluginType string, queryString string, rollup int64, to int64, windowSize int64) {
+	var stats instana.CallStats
+	ctx = instana.WithCallStats(ctx, &stats)
+
+	metrics, err := instana.ListMetricsRange(ctx, api, queryString, pluginType, []string{metricName}, to-windowSize, to, rollup)
+	var partial *instana.PartialError
+	if errors.As(err, &partial) && !partial.Complete() {
+		log.Printf("warning %v\n", err)
+	} else if errors.Is(err, instana.ErrNoMetrics) {
+		log.Fatalf("error retrieving metrics: %v, run `infraq lint-query -query=%q` to check the query\n", err, queryString)
+	} else if err != nil {
+		log.Fatalf("error retrieving metrics: %v\n", err)
 	}
+	for _, c := range instana.CompletenessReport(metrics, metricName, to-windowSize, to, rollup) {
+		if len(c.Gaps) > 0 {
+			log.Printf("warning %s:%s is missing %d of %d points in %d gaps\n", c.Host, c.Label, c.Expected-c.Present, c.Expected, len(c.Gaps))
+		}
+	}
+	metrics = instana.TransformItems(metrics, metricName, transform)
 
-	metrics, err := api.ListMetrics(queryString, pluginType, []string{metricName}, rollup, windowSize, to)
-	if err != nil {
-		log.Fatalf("error retrieving metrics: %v\n", err)
+	var items = instana.Enriched(metrics)
+	if details != nil {
+		enriched, err := instana.EnrichMetrics(ctx, details, metrics)
+		if err != nil {
+			log.Printf("warning unable to retrieve snapshot details: %v\n", err)
+		} else {
+			items = enriched
+		}
+	}
+	if groupBy != nil {
+		writeGroupCharts(instana.GroupBy(items, groupBy), metricName, cores, agg, rollup)
+	} else {
+		writeCharts(items, metricName, cores, rollup)
 	}
-	writeCharts(metrics, metricName)
 
 	/*
-		snapshots, err := api.ListSnapshots(queryString, pluginType, windowSize)
+		snapshots, err := api.ListSnapshotsContext(ctx, queryString, pluginType, windowSize)
 		if err != nil {
 			log.Fatalf("error retrieving snapshots: %v\n", err)
 		}
@@ -47,70 +75,207 @@ func Exec(apiToken string, apiURL string, metricName string, pluginType string,
 	*/
 
 	log.Printf("Metrics:     %v\n", len(metrics))
+	log.Printf("Attempts:    %v\n", stats.Attempts())
 }
 
 func main() {
-	var apiToken = os.Getenv("INSTANA_TOKEN")
-	var apiURL = os.Getenv("INSTANA_URL")
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			err := run(os.Args[2:], os.Stdout)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+	}
 
+	var client cli.ClientFlags
 	var metricName string
 	var pluginType string
 	var queryString string
 	var toString string
+	var tzString string
 	var windowString string
+	var rollupString string
+	var timeout time.Duration
+	var retries int
+	var cacheDir string
+	var cacheTTL time.Duration
+	var noCache bool
+	var noValidate bool
+	var showDetails bool
+	var cores bool
+	var transformName string
+	var perString string
+	var fillString string
+	var groupByString string
+	var aggName string
 
 	flag.StringVar(&metricName, "metric", "cpu.user", "Metric name to extract")
 	flag.StringVar(&queryString, "query", "entity.zone:us-east-2", "Infrastructure query to use as part of the metrics request")
 	flag.StringVar(&pluginType, "plugin", "host", "Snapshot plugin type (e.g. host)")
-	flag.StringVar(&toString, "to", time.Now().UTC().Format("2006-01-02"), "date time in the format, omitting the clock assumes midnight (YYYY-MM-DD hh:mm:ss)")
-	flag.StringVar(&windowString, "window", "60s", `metric window size (valid time units are "s", "m", "h")`)
-
+	flag.StringVar(&toString, "to", "today", "end of the window: a date with an optional clock (YYYY-MM-DD hh:mm:ss), optionally followed by a time zone name, RFC3339, epoch milliseconds or now/today/yesterday with an offset (e.g. now-6h)")
+	flag.StringVar(&tzString, "tz", "UTC", `time zone of -to values without an offset or zone name (e.g. "Local" or "Europe/Berlin")`)
+	flag.StringVar(&windowString, "window", "60s", `metric window size (valid time units are "s", "m", "h", "d", "w")`)
+	flag.StringVar(&rollupString, "rollup", "auto", `metric rollup (one of "1s", "5s", "1m", "5m", "1h" or "auto")`)
+	flag.DurationVar(&timeout, "timeout", 2*time.Minute, "maximum time to wait for the Instana API before giving up")
+	flag.IntVar(&retries, "retries", instana.DefaultRetryPolicy.MaxAttempts-1, "number of times to retry rate limited and transient failures")
+	defaultCacheDir, _ := instana.DefaultCacheDir()
+	flag.StringVar(&cacheDir, "cache-dir", defaultCacheDir, "directory used to cache API responses")
+	flag.DurationVar(&cacheTTL, "cache-ttl", time.Hour, "how long recent windows and snapshot lists are cached, windows well in the past never expire")
+	flag.BoolVar(&noCache, "no-cache", false, "bypass the response cache")
+	flag.BoolVar(&noValidate, "no-validate", false, "skip checking the plugin and metric names against the catalog")
+	flag.BoolVar(&showDetails, "details", false, "title charts with snapshot properties such as the CPU count, namespace and node")
+	flag.StringVar(&transformName, "transform", "none", `transform applied to the metric before charting: "none", "rate" for counters such as calls, which handles counter resets, or "derivative"`)
+	flag.StringVar(&perString, "per", "second", `unit of -transform rates: "second" or "rollup"`)
+	flag.StringVar(&fillString, "fill", "none", `fill missing points with "none", which draws gaps as breaks in the line, "previous", "linear" or "zero"`)
+	flag.StringVar(&groupByString, "group-by", "", "chart one aggregate per group instead of one chart per snapshot: host, plugin, tag:<prefix> (e.g. tag:zone), label:<regexp> or property:<name>")
+	flag.StringVar(&aggName, "agg", "mean", "aggregator of -group-by charts, e.g. sum, mean, max or p90")
+	flag.BoolVar(&cores, "cores", false, "multiply the metric by the host's CPU count, converting cpu.* fractions to cores (implies -details)")
+
+	client.Register(flag.CommandLine)
+
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags]\n       %s <%s> [flags]\n\n", os.Args[0], os.Args[0], strings.Join(subcommandNames(), "|"))
+		fmt.Fprintln(out, "Charts a metric for each matching snapshot, the subcommands browse the catalog and snapshots and check queries.")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	err := client.Resolve(flag.CommandLine)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if client.Query != "" && !cli.IsSet(flag.CommandLine, "query") {
+		queryString = client.Query
+	}
+
 	windowSize, err := instana.ParseDuration(windowString)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	rollup, err := rollupForWindow(windowSize)
+	rollup := instana.AutoRollup(windowSize)
+	if rollupString != "auto" {
+		d, err := time.ParseDuration(rollupString)
+		if err != nil {
+			log.Fatalf("Invalid rollup: %v\n", err)
+		}
+		rollup = int64(d / time.Second)
+	}
+	err = instana.ValidateRollup(rollup)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	log.Printf("API Key Set: %v\n", apiToken != "")
-	log.Printf("API URL:     %v\n", apiURL)
+	log.Printf("API Key Set: %v\n", client.Token != "")
+	log.Printf("API URL:     %v\n", client.URL)
+	log.Printf("Profile:     %v\n", client.ProfileName)
 	log.Printf("Metric:      %v\n", metricName)
 	log.Printf("Plugin:      %v\n", pluginType)
 	log.Printf("Query:       %v\n", queryString)
 	log.Printf("Rollup:      %v\n", time.Duration(rollup)*time.Second)
-	log.Printf("To:          %v\n", toString)
+	unit, err := instana.ParseRateUnit(perString, rollup)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	transform, err := instana.ParseTransform(transformName, unit)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fill, err := instana.ParseFillStrategy(fillString)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if fill != instana.FillNone {
+		transform = instana.Chain(fill.Transform(rollup), transform)
+	}
+	var groupBy instana.GroupKey
+	if groupByString != "" {
+		groupBy, err = instana.ParseGroupBy(groupByString)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Group By:    %v\n", groupByString)
+	}
+	agg, err := instana.LookupAggregator(aggName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Transform:   %v\n", transformName)
+	loc, err := time.LoadLocation(tzString)
+	if err != nil {
+		log.Fatalf("Invalid time zone: %v\n", err)
+	}
+	toTime, err := instana.ParseTime(toString, time.Now(), loc)
+	if err != nil {
+		log.Fatalf("Invalid date time supplied for 'to': %v\n", err)
+	}
+	to := toTime.UnixNano() / int64(time.Millisecond)
+
+	log.Printf("To:          %v\n", toTime.Format(time.RFC3339))
 	log.Printf("Window Size: %v\n", time.Duration(windowSize/1000)*time.Second)
+	log.Printf("Timeout:     %v\n", timeout)
+	log.Printf("Cache:       %v\n", !noCache && cacheDir != "")
 
-	if apiToken == "" {
-		log.Fatalln("INSTANA_TOKEN environment variable should be set to the Instana API token. Was a k8s secret created for this?")
+	err = client.Validate()
+	if err != nil {
+		log.Fatalln(err)
 	}
 
-	if apiURL == "" {
-		log.Fatalln("INSTANA_URL environment variable should be set to the Instana API end-point. Was a k8s secret created for this?")
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go cancelOnSignal(cancel)
 
-	to, err := instana.ToInstanaTS(toString)
+	policy := instana.DefaultRetryPolicy
+	policy.MaxAttempts = retries + 1
+	api, err := client.NewQuery(instana.WithRetryPolicy(policy))
 	if err != nil {
-		log.Fatalf("Invalid date time supplied for 'to': %v\n", err)
+		log.Fatalf("unable to create client: %v\n", err)
+	}
+	var details instana.SnapshotGetter
+	if showDetails || cores || instana.NeedsSnapshot(groupByString) {
+		details, _ = api.(instana.SnapshotGetter)
+	}
+	if !noCache && cacheDir != "" {
+		api = instana.NewCache(api, cacheDir, client.ProfileName+" "+client.URL, cacheTTL)
+	}
+
+	if !noValidate {
+		catalog, err := client.NewCatalog(instana.WithRetryPolicy(policy))
+		if err != nil {
+			log.Fatalf("unable to create client: %v\n", err)
+		}
+		err = instana.ValidateMetrics(ctx, catalog, pluginType, []string{metricName})
+		if err != nil {
+			log.Fatalln(err)
+		}
 	}
 
-	Exec(apiToken, apiURL, metricName, pluginType, queryString, rollup, to, windowSize)
+	Exec(ctx, api, details, cores, transform, groupBy, agg, metricName, pluginType, queryString, rollup, to, windowSize)
+}
+
+// cancelOnSignal cancels in-flight API calls when the process is interrupted.
+func cancelOnSignal(cancel context.CancelFunc) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	cancel()
 }
 
-func writeCharts(metrics []openapi.MetricItem, metricName string) {
+func writeCharts(metrics []instana.EnrichedItem, metricName string, cores bool, rollup int64) {
 	for _, item := range metrics {
 		shortName := shortenMetric(metricName)
 		prefix := strings.Replace(item.Host, ":", "-", -1) + "-" + shortName
 		if prefix == "" {
 			prefix = strings.Replace(item.Label, "/", "-", -1)
 		}
+		if tenant := instana.TenantOf(item.Tags); tenant != "" {
+			prefix = tenant + "-" + prefix
+		}
 
-		lineChart := newChart(&item, metricName)
+		lineChart := newChart(&item, metricName, cores, rollup)
 		if lineChart == nil {
 			continue
 		}
@@ -122,23 +287,6 @@ func writeCharts(metrics []openapi.MetricItem, metricName string) {
 	}
 }
 
-func rollupForWindow(windowSize int64) (int64, error) {
-	rollup := windowSize / 1000 / 600
-	if rollup <= 1 {
-		return 1, nil
-	} else if rollup <= 5 {
-		return 5, nil
-	} else if rollup <= 60 {
-		return 60, nil
-	} else if rollup <= 300 {
-		return 300, nil
-	} else if rollup <= 3600 {
-		return 3600, nil
-	}
-
-	return 0, errors.New("rollup is too large for API call, maximum call size is 25 days")
-}
-
 func renderChart(name string, lineChart *chart.Chart) error {
 	buffer := bytes.NewBuffer([]byte{})
 	err := lineChart.Render(chart.PNG, buffer)
@@ -160,45 +308,99 @@ func renderChart(name string, lineChart *chart.Chart) error {
 	return nil
 }
 
-func newChart(item *openapi.MetricItem, metricName string) *chart.Chart {
-	metricsLen := len(item.Metrics[metricName])
-	if metricsLen < 2 {
-		log.Printf("no metrics available: %s:%s\n", item.Host, item.Label)
-		return nil
+func newChart(item *instana.EnrichedItem, metricName string, cores bool, rollup int64) *chart.Chart {
+	var metric = item.Metrics[metricName]
+	var seriesName = metricName
+	if cores {
+		scaled, ok := item.Cores(metricName)
+		if !ok {
+			log.Printf("no CPU count available: %s:%s\n", item.Host, item.Label)
+			return nil
+		}
+		metric = scaled
+		seriesName = metricName + " (cores)"
 	}
 
-	xValues := make([]float64, metricsLen)
-	yValues := make([]float64, metricsLen)
+	return lineChart(item.Title(), seriesName, instana.NewSeries(metric), rollup, item.Host+":"+item.Label)
+}
 
-	var min = math.MaxFloat64
-	var max = math.SmallestNonzeroFloat64
-	var metric = item.Metrics[metricName]
-	var previous float64
-	for i, v := range metric {
-		var timestamp = float64(v[SeriesTimestamp])
-		var value = float64(v[SeriesValue])
-		if math.IsInf(value, 0) || math.IsNaN(value) {
-			value = 0.0
+// writeGroupCharts renders a chart of the agg of each group. With cores the metric of each item is scaled
+// by its CPU count before aggregating, items without a CPU count are left out.
+func writeGroupCharts(groups []instana.ItemGroup, metricName string, cores bool, agg instana.Aggregator, rollup int64) {
+	for _, g := range groups {
+		seriesName := metricName + " (" + agg.Name + ")"
+		items := g.MetricItems()
+		if cores {
+			items = items[:0]
+			for _, item := range g.Items {
+				scaled, ok := item.Cores(metricName)
+				if !ok {
+					log.Printf("no CPU count available: %s:%s\n", item.Host, item.Label)
+					continue
+				}
+				item.Metrics = map[string][][]float64{metricName: scaled}
+				items = append(items, item.MetricItem)
+			}
+			seriesName = metricName + " (cores, " + agg.Name + ")"
 		}
 
-		if value < min {
-			min = value
+		series := instana.Aggregate(items, metricName, agg, instana.SkipNonFinite)
+		title := fmt.Sprintf("%s (%d snapshots)", g.Key, len(g.Items))
+		groupChart := lineChart(title, seriesName, series, rollup, g.Key)
+		if groupChart == nil {
+			continue
 		}
-		if value > max {
-			max = value
+
+		name := strings.NewReplacer(":", "-", "/", "-", " ", "-").Replace(g.Key) + "-" + shortenMetric(metricName) + "-" + agg.Name
+		err := renderChart(name, groupChart)
+		if err != nil {
+			log.Printf("error rendering chart %s: %v\n", name, err.Error())
 		}
+	}
+}
+
+// lineChart charts series titled title, name identifies the series in log messages.
+func lineChart(title string, seriesName string, metric instana.Series, rollup int64, name string) *chart.Chart {
+	// each segment is drawn as its own line so gaps and NaN values show as breaks rather than drops to 0
+	segments := metric.Segments(rollup)
+	var metricsLen int
+	for _, segment := range segments {
+		metricsLen += len(segment)
+	}
+	if metricsLen < 2 {
+		log.Printf("no metrics available: %s\n", name)
+		return nil
+	}
 
-		xValues[i] = timestamp
-		yValues[i] = value
+	var min = math.MaxFloat64
+	var max = math.SmallestNonzeroFloat64
+	var series = make([]chart.Series, 0, len(segments))
+	for i, segment := range segments {
+		xValues := make([]float64, len(segment))
+		yValues := make([]float64, len(segment))
+		for j, p := range segment {
+			if p.Value < min {
+				min = p.Value
+			}
+			if p.Value > max {
+				max = p.Value
+			}
+
+			xValues[j] = float64(p.Timestamp)
+			yValues[j] = p.Value
+		}
 
-		if timestamp <= previous {
-			log.Printf("warning timestamps out of order %f >= %f: %f %v\n", previous, timestamp, value, int64(v[SeriesTimestamp]))
+		s := chart.ContinuousSeries{
+			XValues: xValues,
+			YValues: yValues,
+			Style:   chart.Style{Show: true, StrokeColor: chart.GetDefaultColor(0)},
+		}
+		if i == 0 {
+			s.Name = seriesName
 		}
-		previous = timestamp
+		series = append(series, s)
 	}
-	fmt.Println("len =", metricsLen, item.Label, " delta=", max-min)
-
-	title := item.Label
+	fmt.Println("len =", metricsLen, name, " delta=", max-min, " segments=", len(segments))
 
 	graph := &chart.Chart{
 		Title:      title,
@@ -224,17 +426,14 @@ func newChart(item *openapi.MetricItem, metricName string) *chart.Chart {
 		},
 		Width:  900,
 		Height: 550,
-		Series: []chart.Series{
-			chart.ContinuousSeries{
-				XValues: xValues,
-				YValues: yValues,
-				Name:    metricName,
-			},
-		},
+		Series: series,
 	}
 
+	// the legend only lists the first segment, the others are the same series
+	legend := *graph
+	legend.Series = series[:1]
 	graph.Elements = []chart.Renderable{
-		chart.Legend(graph),
+		chart.Legend(&legend),
 	}
 
 	return graph
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/nfisher/instana-crib"
+)
+
+func runTopology(args []string, out io.Writer) error {
+	var snapshotID string
+	var dot bool
+	s := newSubcommand("topology")
+	s.fs.StringVar(&snapshotID, "snapshot", "", "only print this snapshot's ancestors and descendants, including its related hosts")
+	s.fs.BoolVar(&dot, "dot", false, "print Graphviz DOT instead of a table")
+	ctx, cancel, err := s.parse(args)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	api, err := s.client.NewQuery()
+	if err != nil {
+		return err
+	}
+	topology, ok := api.(instana.InfraTopology)
+	if !ok {
+		return errors.New("topology is only available for a single profile")
+	}
+
+	var related []string
+	if snapshotID != "" {
+		related = append(related, snapshotID)
+	}
+	g, err := instana.BuildTopology(ctx, topology, related...)
+	if errors.Is(err, instana.ErrNotFound) && snapshotID != "" {
+		return errors.New("snapshot " + snapshotID + " not found")
+	} else if err != nil {
+		return err
+	}
+	if snapshotID != "" {
+		if _, ok := g.Node(snapshotID); !ok {
+			return errors.New("snapshot " + snapshotID + " is not in the view tree")
+		}
+		g = g.Subgraph(snapshotID)
+	}
+
+	if dot {
+		return g.WriteDOT(out)
+	}
+	var rows [][]string
+	for _, n := range g.Nodes() {
+		rows = append(rows, []string{n.ID, n.Type, strings.Join(g.Parents(n.ID), ","), strings.Join(g.Children(n.ID), ",")})
+	}
+	return s.print(out, g, []string{"SNAPSHOT", "TYPE", "PARENTS", "CHILDREN"}, rows)
+}
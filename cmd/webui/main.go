@@ -2,19 +2,26 @@ package main
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/csv"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
+	"strconv"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/internal/cli"
 	"github.com/nfisher/instana-crib/pkg/instana/openapi"
 )
 
@@ -25,44 +32,326 @@ const (
 	SeriesValue = 1
 )
 
+// entity is a group of snapshots polled for the dashboard, Name is the value of the entity request parameter.
+type entity struct {
+	Name    string
+	Query   instana.Query
+	Plugin  string
+	Metrics []string
+}
+
+var entities = []entity{
+	//
+	// == acceptor ==
+	// "plugin":"dropwizardApplicationContainer",
+	// "query":"appdata-writer",
+	//
+	// metrics.guage.KPI.outgoing.spans.error_rate
+	//
+	// == ad-writer ==
+	// metrics.gauges.KPI.incoming.raw_spans.error_rate
+	//
+	{
+		Name:   "appdataWriter",
+		Query:  instana.Wildcard("entity.label", "*appdata-writer*"),
+		Plugin: "dropwizardApplicationContainer",
+		Metrics: []string{
+			"metrics.gauges.KPI.incoming.raw_spans.error_rate",
+			"metrics.meters.KPI.incoming.raw_spans.calls",
+		},
+	},
+	// == ad-processor ==
+	// "plugin":"dropwizardApplicationContainer",
+	// "query":"appdata-processor",
+	//
+	// metrics.gauges.KPI.incoming.span_messages.error_rate
+	//
+	{
+		Name:   "appdataProcessor",
+		Query:  instana.Wildcard("entity.label", "*appdata-processor*"),
+		Plugin: "dropwizardApplicationContainer",
+		Metrics: []string{
+			"metrics.gauges.KPI.incoming.span_messages.error_rate",
+			"metrics.meters.KPI.incoming.span_messages.calls",
+		},
+	},
+	// == filler ==
+	// "plugin":"dropwizardApplicationContainer",
+	// "query":"filler",
+	// metrics.guage.KPI.incoming.raw_messages.error_rate
+	//
+	{
+		Name:   "filler",
+		Query:  instana.Wildcard("entity.label", "filler*"),
+		Plugin: "dropwizardApplicationContainer",
+		Metrics: []string{
+			"metrics.gauges.KPI.incoming.raw_messages.error_rate",
+			"metrics.gauges.com.instana.filler.service.snapshot.OnlineSnapshotsLimit.online-snapshots-count",
+		},
+	},
+	{
+		Name:    "host",
+		Query:   instana.And(instana.Field("entity.type", "host"), instana.Wildcard("entity.zone", "Instana-*")),
+		Plugin:  "host",
+		Metrics: []string{"cpu.user", "cpu.sys", "cpu.wait"},
+	},
+}
+
+// Timeseries is an aggregated series and its summary statistics, NaN and infinite values are null.
 type Timeseries struct {
-	Values []float64 `json:"values"`
+	Timestamps []int64             `json:"timestamps"`
+	Values     []*float64          `json:"values"`
+	Stats      map[string]*float64 `json:"stats"`
 }
 
-func main() {
-	var apiToken = os.Getenv("INSTANA_TOKEN")
-	var apiURL = os.Getenv("INSTANA_URL")
+func newTimeseries(series instana.Series) Timeseries {
+	ts := Timeseries{
+		Timestamps: series.Timestamps(),
+		Values:     make([]*float64, len(series)),
+		Stats:      make(map[string]*float64),
+	}
+	for i, v := range series.Values() {
+		ts.Values[i] = finite(v, true)
+	}
+	for _, agg := range []instana.Aggregator{instana.AggP99, instana.AggMax} {
+		ts.Stats[agg.Name] = finite(series.Reduce(agg, instana.SkipNonFinite))
+	}
+	if len(series) > 0 {
+		ts.Stats["last"] = finite(series[len(series)-1].Value, true)
+	}
+	return ts
+}
+
+// finite returns a pointer to v, or nil if v is not ok, NaN or infinite.
+func finite(v float64, ok bool) *float64 {
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// transformOf applies the transform form value (none, rate or derivative) to metric, rates are per the per
+// form value (second or rollup). If set the fill form value (none, previous, linear or zero) fills the gaps
+// of each item first, none inserts nulls.
+func transformOf(items []openapi.MetricItem, metric string, form url.Values, rollup int64) ([]openapi.MetricItem, error) {
+	unit, err := instana.ParseRateUnit(form.Get("per"), rollup)
+	if err != nil {
+		return nil, err
+	}
+	transform, err := instana.ParseTransform(form.Get("transform"), unit)
+	if err != nil {
+		return nil, err
+	}
+	if s := form.Get("fill"); s != "" {
+		fill, err := instana.ParseFillStrategy(s)
+		if err != nil {
+			return nil, err
+		}
+		transform = instana.Chain(fill.Transform(rollup), transform)
+	}
+	return instana.TransformItems(items, metric, transform), nil
+}
+
+// aggregatorOf returns the aggregator named by the agg form value, sum by default, and the NaN/Inf policy
+// of the nonfinite form value, skip by default.
+func aggregatorOf(form url.Values) (instana.Aggregator, instana.NonFinitePolicy, error) {
+	aggName := form.Get("agg")
+	if aggName == "" {
+		aggName = instana.AggSum.Name
+	}
+	agg, err := instana.LookupAggregator(aggName)
+	if err != nil {
+		return instana.Aggregator{}, 0, err
+	}
+	policy, err := instana.ParseNonFinitePolicy(form.Get("nonfinite"))
+	if err != nil {
+		return instana.Aggregator{}, 0, err
+	}
+	return agg, policy, nil
+}
+
+// groupsOf partitions items by the by form value, see instana.ParseGroupBy. Grouping by a snapshot property
+// retrieves the snapshots with details.
+func groupsOf(ctx context.Context, items []openapi.MetricItem, form url.Values, details instana.SnapshotGetter) ([]instana.ItemGroup, error) {
+	by := form.Get("by")
+	key, err := instana.ParseGroupBy(by)
+	if err != nil {
+		return nil, err
+	}
+
+	enriched := instana.Enriched(items)
+	if instana.NeedsSnapshot(by) {
+		if details == nil {
+			return nil, fmt.Errorf("grouping by %s requires snapshot details, which the client does not support", by)
+		}
+		enriched, err = instana.EnrichMetrics(ctx, details, items)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return instana.GroupBy(enriched, key), nil
+}
+
+// selectGroup returns the items of the group named by the key form value if the by form value is set,
+// otherwise items. An unknown key selects no items as groups come and go with their snapshots.
+func selectGroup(ctx context.Context, items []openapi.MetricItem, form url.Values, details instana.SnapshotGetter) ([]openapi.MetricItem, error) {
+	if form.Get("by") == "" {
+		return items, nil
+	}
+	groups, err := groupsOf(ctx, items, form, details)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Key == form.Get("key") {
+			return g.MetricItems(), nil
+		}
+	}
+	return nil, nil
+}
+
+// snapshotMemo remembers snapshots for ttl so grouping by a snapshot property doesn't request every snapshot
+// on each refresh of the dashboard while property changes are still picked up. It forgets everything once
+// it holds maxSnapshots.
+type snapshotMemo struct {
+	next      instana.SnapshotGetter
+	ttl       time.Duration
+	mu        sync.Mutex
+	snapshots map[string]memoSnapshot
+}
+
+type memoSnapshot struct {
+	snapshot instana.Snapshot
+	expires  time.Time
+}
+
+const maxSnapshots = 10000
 
+func (m *snapshotMemo) GetSnapshotContext(ctx context.Context, id string) (instana.Snapshot, error) {
+	m.mu.Lock()
+	e, ok := m.snapshots[id]
+	m.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.snapshot, nil
+	}
+
+	s, err := m.next.GetSnapshotContext(ctx, id)
+	if err != nil {
+		return s, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snapshots == nil || len(m.snapshots) >= maxSnapshots {
+		m.snapshots = make(map[string]memoSnapshot)
+	}
+	m.snapshots[id] = memoSnapshot{snapshot: s, expires: time.Now().Add(m.ttl)}
+	return s, nil
+}
+
+// heatmapOf buckets metric across items with the buckets, scale, min, max and quantile form values. Without
+// any of them the values are treated as percentages in 5% buckets.
+func heatmapOf(items []openapi.MetricItem, metric string, form url.Values) (instana.Heatmap, error) {
+	var custom bool
+	for _, k := range []string{"buckets", "scale", "min", "max", "quantile"} {
+		custom = custom || form.Get(k) != ""
+	}
+	if !custom {
+		return instana.ToPercentageHeatmap(items, metric).Heatmap(), nil
+	}
+
+	var opts instana.HeatmapOptions
+	var err error
+	opts.Scale, err = instana.ParseBucketScale(form.Get("scale"))
+	if err != nil {
+		return instana.Heatmap{}, err
+	}
+	if s := form.Get("buckets"); s != "" {
+		opts.Buckets, err = strconv.Atoi(s)
+		if err != nil {
+			return instana.Heatmap{}, fmt.Errorf("invalid buckets %q: %w", s, err)
+		}
+	}
+	for k, v := range map[string]*float64{"min": &opts.Min, "max": &opts.Max, "quantile": &opts.Quantile} {
+		if s := form.Get(k); s != "" {
+			*v, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				return instana.Heatmap{}, fmt.Errorf("invalid %s %q: %w", k, s, err)
+			}
+		}
+	}
+	return instana.NewHeatmap(items, metric, opts)
+}
+
+func main() {
+	var client cli.ClientFlags
 	var windowString string
+	var toString string
+	var tzString string
+	var timeout time.Duration
+	var snapshotTTL time.Duration
+
+	flag.StringVar(&windowString, "window", "60s", `metric window size (valid time units are "s", "m", "h", "d", "w")`)
+	flag.StringVar(&toString, "to", "now", "end of the window, evaluated on every poll so relative expressions such as now-5m follow the clock")
+	flag.StringVar(&tzString, "tz", "UTC", `time zone of -to values without an offset or zone name (e.g. "Local" or "Europe/Berlin")`)
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "maximum time to wait for each poll of the Instana API")
+	flag.DurationVar(&snapshotTTL, "snapshot-ttl", 10*time.Minute, "how long snapshot details used to group by a property are reused")
 
-	flag.StringVar(&windowString, "window", "60s", `metric window size (valid time units are "s", "m", "h")`)
+	client.Register(flag.CommandLine)
 
 	flag.Parse()
 
-	windowSize, err := instana.ParseDuration(windowString)
+	err := client.Resolve(flag.CommandLine)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	rollup, err := rollupForWindow(windowSize)
+	windowSize, err := instana.ParseDuration(windowString)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	if apiToken == "" {
-		log.Fatalln("INSTANA_TOKEN environment variable should be set to the Instana API token. Was a k8s secret created for this?")
+	rollup, err := instana.RollupForWindow(windowSize)
+	if err != nil {
+		log.Fatalln(err)
 	}
 
-	if apiURL == "" {
-		log.Fatalln("INSTANA_URL environment variable should be set to the Instana API end-point. Was a k8s secret created for this?")
+	loc, err := time.LoadLocation(tzString)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_, err = instana.ParseTime(toString, time.Now(), loc)
+	if err != nil {
+		log.Fatalln(err)
 	}
 
-	log.Println("URL:", apiURL)
+	log.Println("URL:", client.URL)
+
+	api, err := client.NewQuery()
+	if err != nil {
+		log.Fatalf("unable to create client: %v\n", err)
+	}
 
-	api, err := instana.NewClient(apiURL, apiToken)
+	catalog, err := client.NewCatalog()
 	if err != nil {
 		log.Fatalf("unable to create client: %v\n", err)
 	}
+	var details instana.SnapshotGetter
+	if getter, ok := api.(instana.SnapshotGetter); ok {
+		details = &snapshotMemo{next: getter, ttl: snapshotTTL}
+	}
+
+	checkCtx, checkCancel := context.WithTimeout(context.Background(), timeout)
+	for _, e := range entities {
+		err := instana.ValidateMetrics(checkCtx, catalog, e.Plugin, e.Metrics)
+		if err == nil {
+			err = instana.ValidateQuery(checkCtx, catalog, e.Query)
+		}
+		if err != nil {
+			log.Printf("warning %s: %v\n", e.Name, err)
+		}
+	}
+	checkCancel()
 
 	var metricValue atomic.Value
 	m := map[string][]openapi.MetricItem{
@@ -70,105 +359,50 @@ func main() {
 	}
 	metricValue.Store(m)
 
-	go func(api instana.InfraQuery) {
-		c := time.Tick(1 * time.Second)
-		for next := range c {
-			_ = next
-			toString := time.Now().UTC().Format("2006-01-02 15:04:05")
-			to, err := instana.ToInstanaTS(toString)
-			if err != nil {
-				log.Printf("Invalid date time supplied for 'to': %v\n", err)
-			}
-
-			////
-			//
-			// == acceptor ==
-			// "plugin":"dropwizardApplicationContainer",
-			// "query":"appdata-writer",
-			//
-			// metrics.guage.KPI.outgoing.spans.error_rate
-			//
-			// == ad-writer ==
-			// metrics.gauges.KPI.incoming.raw_spans.error_rate
-			//
-			adWriterMetrics, err := api.ListMetrics(
-				"entity.label:*appdata-writer*",
-				"dropwizardApplicationContainer",
-				[]string{
-					"metrics.gauges.KPI.incoming.raw_spans.error_rate",
-					"metrics.meters.KPI.incoming.raw_spans.calls",
-				},
-				rollup,
-				windowSize,
-				to)
-			if err != nil {
-				log.Printf(err.Error())
-			}
-
-			// == ad-processor ==
-			// "plugin":"dropwizardApplicationContainer",
-			// "query":"appdata-processor",
-			//
-			// metrics.gauges.KPI.incoming.span_messages.error_rate
-			//
-			adProcessorMetrics, err := api.ListMetrics(
-				"entity.label:*appdata-processor*",
-				"dropwizardApplicationContainer",
-				[]string{
-					"metrics.gauges.KPI.incoming.span_messages.error_rate",
-					"metrics.meters.KPI.incoming.span_messages.calls",
-				},
-				rollup,
-				windowSize,
-				to)
-			if err != nil {
-				log.Printf(err.Error())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func(ctx context.Context, api instana.InfraQueryContext) {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
 			}
 
-			// == filler ==
-			// "plugin":"dropwizardApplicationContainer",
-			// "query":"filler",
-			// metrics.guage.KPI.incoming.raw_messages.error_rate
-			//
-			fillerMetrics, err := api.ListMetrics(
-				"entity.label:filler*",
-				"dropwizardApplicationContainer",
-				[]string{
-					"metrics.gauges.KPI.incoming.raw_messages.error_rate",
-					"metrics.gauges.com.instana.filler.service.snapshot.OnlineSnapshotsLimit.online-snapshots-count",
-				},
-				rollup,
-				windowSize,
-				to)
+			reqCtx, reqCancel := context.WithTimeout(ctx, timeout)
+			toTime, err := instana.ParseTime(toString, time.Now(), loc)
 			if err != nil {
-				log.Printf(err.Error())
+				log.Printf("Invalid date time supplied for 'to': %v\n", err)
 			}
-
-			hostMetrics, err := api.ListMetrics(
-				"entity.type:host AND entity.zone:Instana-*",
-				"host",
-				[]string{ "cpu.user", "cpu.sys", "cpu.wait" },
-				rollup,
-				windowSize,
-				to)
-			if err != nil {
-				log.Printf(err.Error())
+			to := toTime.UnixNano() / int64(time.Millisecond)
+
+			var m = make(map[string][]openapi.MetricItem, len(entities))
+			for _, e := range entities {
+				items, err := api.ListMetricsContext(reqCtx, e.Query.String(), e.Plugin, e.Metrics, rollup, windowSize, to)
+				if err != nil {
+					log.Printf(err.Error())
+				}
+				m[e.Name] = items
 			}
+			reqCancel()
 
-			m := map[string][]openapi.MetricItem{
-				"appdataProcessor": adProcessorMetrics,
-				"appdataWriter": adWriterMetrics,
-				"filler": fillerMetrics,
-				"host":   hostMetrics,
+			if ctx.Err() != nil {
+				return
 			}
 
 			metricValue.Store(m)
 		}
-	}(api)
+	}(ctx, api)
 
 	var reMetricName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
-	http.HandleFunc("/ts_sum", func(w http.ResponseWriter, req *http.Request) {
+	// aggregate serves the per-timestamp aggregate of a metric across an entity's items along with the
+	// p99, max and last value of the aggregate. agg defaults to sum and nonfinite to skip, transform and per
+	// convert counters to rates first. by and key restrict the items to one group.
+	aggregate := func(w http.ResponseWriter, req *http.Request) {
 		err := req.ParseForm()
 		if err != nil {
 			http.Error(w, fmt.Sprintf("error parsing submitted values: %v", err), http.StatusInternalServerError)
@@ -183,6 +417,12 @@ func main() {
 			return
 		}
 
+		agg, policy, err := aggregatorOf(req.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		metrics := metricValue.Load().(map[string][]openapi.MetricItem)
 		metric, ok := metrics[entityName]
 		if !ok {
@@ -190,12 +430,20 @@ func main() {
 			return
 		}
 
-		values := instana.Sum(metric, metricName)
-		ts := Timeseries {
-			Values: values,
+		metric, err = selectGroup(req.Context(), metric, req.Form, details)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metric, err = transformOf(metric, metricName, req.Form, rollup)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		w.Header().Set("Content-type", "text/csv")
+		ts := newTimeseries(instana.Aggregate(metric, metricName, agg, policy))
+
+		w.Header().Set("Content-type", "application/json")
 		w.Header().Set("Content-Encoding", "gzip")
 		gz := gzip.NewWriter(w)
 		defer gz.Close()
@@ -204,8 +452,106 @@ func main() {
 			http.Error(w, fmt.Sprintf("error json encoding values: %v", err), http.StatusInternalServerError)
 			return
 		}
+	}
+	http.HandleFunc("/aggregate", aggregate)
+	http.HandleFunc("/ts_sum", aggregate)
+
+	// groups lists the groups of an entity's items by the by form value along with their number of snapshots.
+	http.HandleFunc("/groups", func(w http.ResponseWriter, req *http.Request) {
+		err := req.ParseForm()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error parsing submitted values: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		metrics := metricValue.Load().(map[string][]openapi.MetricItem)
+		metric, ok := metrics[req.Form.Get("entity")]
+		if !ok {
+			http.Error(w, "invalid entity name", http.StatusBadRequest)
+			return
+		}
+
+		groups, err := groupsOf(req.Context(), metric, req.Form, details)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type group struct {
+			Key       string `json:"key"`
+			Snapshots int    `json:"snapshots"`
+		}
+		var keys = make([]group, len(groups))
+		for i, g := range groups {
+			keys[i] = group{Key: g.Key, Snapshots: len(g.Items)}
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		err = json.NewEncoder(w).Encode(keys)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error json encoding values: %v", err), http.StatusInternalServerError)
+			return
+		}
 	})
 
+	// group_aggregate serves the aggregate of each group of an entity's items by the by form value, it
+	// accepts the same form values as aggregate.
+	http.HandleFunc("/group_aggregate", func(w http.ResponseWriter, req *http.Request) {
+		err := req.ParseForm()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error parsing submitted values: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		metricName := req.Form.Get("metric")
+		if !reMetricName.MatchString(metricName) {
+			http.Error(w, "invalid metric name", http.StatusBadRequest)
+			return
+		}
+
+		agg, policy, err := aggregatorOf(req.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		metrics := metricValue.Load().(map[string][]openapi.MetricItem)
+		metric, ok := metrics[req.Form.Get("entity")]
+		if !ok {
+			http.Error(w, "invalid entity name", http.StatusBadRequest)
+			return
+		}
+
+		metric, err = transformOf(metric, metricName, req.Form, rollup)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		groups, err := groupsOf(req.Context(), metric, req.Form, details)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type groupTimeseries struct {
+			Key string `json:"key"`
+			Timeseries
+		}
+		var series []groupTimeseries
+		for _, g := range instana.AggregateGroups(groups, metricName, agg, policy) {
+			series = append(series, groupTimeseries{Key: g.Key, Timeseries: newTimeseries(g.Series)})
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		err = json.NewEncoder(gz).Encode(series)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error json encoding values: %v", err), http.StatusInternalServerError)
+			return
+		}
+	})
 
 	http.HandleFunc("/heatmap_data", func(w http.ResponseWriter, req *http.Request) {
 		err := req.ParseForm()
@@ -229,7 +575,22 @@ func main() {
 			return
 		}
 
-		hist := instana.ToPercentageHeatmap(metric, metricName)
+		metric, err = selectGroup(req.Context(), metric, req.Form, details)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metric, err = transformOf(metric, metricName, req.Form, rollup)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		hist, err := heatmapOf(metric, metricName, req.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		tab := instana.ToTabular(hist)
 		w.Header().Set("Content-type", "text/csv")
 		w.Header().Set("Content-Encoding", "gzip")
@@ -245,23 +606,26 @@ func main() {
 	})
 
 	http.Handle("/", http.FileServer(http.Dir("./html")))
-	log.Println("binding to :8000")
-	http.ListenAndServe(":8000", nil)
-}
 
-func rollupForWindow(windowSize int64) (int64, error) {
-	rollup := windowSize / 1000 / 600
-	if rollup <= 1 {
-		return 1, nil
-	} else if rollup <= 5 {
-		return 5, nil
-	} else if rollup <= 60 {
-		return 60, nil
-	} else if rollup <= 300 {
-		return 300, nil
-	} else if rollup <= 3600 {
-		return 3600, nil
-	}
-
-	return 0, errors.New("rollup is too large for API call, maximum call size is 25 days")
+	srv := &http.Server{Addr: ":8000"}
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+		log.Println("shutting down")
+		cancel()
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeout)
+		defer shutdownCancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("error shutting down server: %v\n", err)
+		}
+	}()
+
+	log.Println("binding to :8000")
+	err = srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatalln(err)
+	}
 }
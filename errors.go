@@ -0,0 +1,101 @@
+package instana
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error kinds returned by calls to the Instana API. Use errors.Is to test for them and errors.As with
+// *APIError to access the HTTP status and body.
+var (
+	// ErrAuth indicates the API token was rejected or lacks the required permissions.
+	ErrAuth = errors.New("authentication failed")
+	// ErrRateLimited indicates the API rate limit was exceeded.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrNotFound indicates the requested resource does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidQuery indicates the request was rejected as malformed, usually due to the query or metric names.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrServer indicates the server failed to process the request or returned an unexpected response.
+	ErrServer = errors.New("server error")
+	// ErrTransport indicates the request did not complete, for example due to DNS, TLS or a cancelled context.
+	ErrTransport = errors.New("transport error")
+)
+
+// ErrNoMetrics is returned when a metrics query succeeds but matches no metrics.
+var ErrNoMetrics = errors.New("no metrics found")
+
+// APIError describes a failed call to the Instana API.
+type APIError struct {
+	// Op describes the operation that failed (e.g. "retrieving metrics").
+	Op string
+	// Kind is one of the Err* error kinds.
+	Kind error
+	// StatusCode is the HTTP status of the final attempt, or 0 if no response was received.
+	StatusCode int
+	// Body is the response body of the final attempt.
+	Body []byte
+	// Attempts is the number of attempts made before giving up.
+	Attempts int
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("error %s after %d attempt(s): %v: %s", e.Op, e.Attempts, e.Err, e.Body)
+	}
+	return fmt.Sprintf("error %s after %d attempt(s): %v", e.Op, e.Attempts, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of this error.
+func (e *APIError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// newAPIError classifies the error from the final attempt of a call.
+func newAPIError(op string, attempts int, resp *http.Response, err error) *APIError {
+	apiErr := &APIError{
+		Op:       op,
+		Kind:     ErrTransport,
+		Attempts: attempts,
+		Err:      err,
+	}
+
+	// openapi.GenericOpenAPIError and responses read without the generated client expose their body.
+	var berr interface{ Body() []byte }
+	if errors.As(err, &berr) {
+		apiErr.Body = berr.Body()
+	}
+
+	if resp == nil {
+		return apiErr
+	}
+
+	apiErr.StatusCode = resp.StatusCode
+	apiErr.Kind = kindForStatus(resp.StatusCode)
+
+	return apiErr
+}
+
+func kindForStatus(status int) error {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status >= 400 && status < 500:
+		return ErrInvalidQuery
+	}
+	// includes 5xx and successful responses which could not be decoded.
+	return ErrServer
+}
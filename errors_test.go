@@ -0,0 +1,99 @@
+package instana_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_ListSnapshotsContext_error_kinds(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		status int
+		kind   error
+	}{
+		"unauthorized":          {http.StatusUnauthorized, instana.ErrAuth},
+		"forbidden":             {http.StatusForbidden, instana.ErrAuth},
+		"too many requests":     {http.StatusTooManyRequests, instana.ErrRateLimited},
+		"not found":             {http.StatusNotFound, instana.ErrNotFound},
+		"bad request":           {http.StatusBadRequest, instana.ErrInvalidQuery},
+		"service unavailable":   {http.StatusServiceUnavailable, instana.ErrServer},
+		"internal server error": {http.StatusInternalServerError, instana.ErrServer},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte("oops"))
+			}))
+			defer srv.Close()
+
+			api, err := instana.NewClient(srv.URL, "token", instana.WithRetryPolicy(instana.NoRetry))
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			_, err = api.ListSnapshotsContext(context.Background(), "entity.zone:test", "host", 60000)
+			if !errors.Is(err, tc.kind) {
+				t.Fatalf("ListSnapshotsContext() error = %v, want %v", err, tc.kind)
+			}
+
+			var apiErr *instana.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("ListSnapshotsContext() error = %T, want *instana.APIError", err)
+			}
+			if apiErr.StatusCode != tc.status {
+				t.Errorf("StatusCode = %v, want %v", apiErr.StatusCode, tc.status)
+			}
+			if string(apiErr.Body) != "oops" {
+				t.Errorf("Body = %q, want %q", apiErr.Body, "oops")
+			}
+		})
+	}
+}
+
+func Test_ListSnapshotsContext_transport_error(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	api, err := instana.NewClient(srv.URL, "token", instana.WithRetryPolicy(instana.NoRetry))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	_, err = api.ListSnapshotsContext(context.Background(), "entity.zone:test", "host", 60000)
+	if !errors.Is(err, instana.ErrTransport) {
+		t.Errorf("ListSnapshotsContext() error = %v, want %v", err, instana.ErrTransport)
+	}
+}
+
+func Test_ListMetricsContext_no_metrics(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer srv.Close()
+
+	api, err := instana.NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	_, err = api.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{CpuUser}, 1, 60000, 0)
+	if err != instana.ErrNoMetrics {
+		t.Errorf("ListMetricsContext() error = %v, want %v", err, instana.ErrNoMetrics)
+	}
+}
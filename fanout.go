@@ -0,0 +1,165 @@
+package instana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// TenantTagPrefix prefixes the tag added to each item returned by a MultiTenantClient to identify its source.
+const TenantTagPrefix = "tenant="
+
+// Tenant is a named Instana unit queried by a MultiTenantClient.
+type Tenant struct {
+	Name   string
+	Client InfraQueryContext
+}
+
+// MultiTenantClient runs each query concurrently against several Instana units and merges the results.
+// Items are tagged with their source tenant, see TenantOf.
+type MultiTenantClient struct {
+	tenants []Tenant
+}
+
+var _ InfraQuery = (*MultiTenantClient)(nil)
+var _ InfraQueryContext = (*MultiTenantClient)(nil)
+
+// NewMultiTenantClient builds a client that fans queries out to tenants.
+func NewMultiTenantClient(tenants ...Tenant) *MultiTenantClient {
+	return &MultiTenantClient{tenants: tenants}
+}
+
+// Tenants returns the tenants queried by the client.
+func (m *MultiTenantClient) Tenants() []Tenant {
+	return m.tenants
+}
+
+// TenantOf returns the tenant an item was retrieved from, or an empty string if it is not tagged.
+func TenantOf(tags []string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, TenantTagPrefix) {
+			return tag[len(TenantTagPrefix):]
+		}
+	}
+	return ""
+}
+
+// PartialError reports the tenants which failed during a MultiTenantClient call. It is returned with
+// the results of the successful tenants, or with no results if every tenant failed.
+type PartialError struct {
+	// Tenants is the number of tenants queried.
+	Tenants int
+	// Errors maps the name of each failed tenant to its error.
+	Errors map[string]error
+}
+
+// Error implements the error interface.
+func (e *PartialError) Error() string {
+	var names []string
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var msgs []string
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, e.Errors[name]))
+	}
+	return fmt.Sprintf("%d of %d tenants failed: %s", len(e.Errors), e.Tenants, strings.Join(msgs, "; "))
+}
+
+// Complete reports whether every tenant failed.
+func (e *PartialError) Complete() bool {
+	return len(e.Errors) == e.Tenants
+}
+
+// fanOut calls fn for every tenant concurrently. It returns a *PartialError if any tenant failed,
+// a tenant returning ErrNoMetrics is not considered to have failed.
+func (m *MultiTenantClient) fanOut(fn func(i int, t Tenant) error) error {
+	var wg sync.WaitGroup
+	var errs = make([]error, len(m.tenants))
+	for i, t := range m.tenants {
+		wg.Add(1)
+		go func(i int, t Tenant) {
+			defer wg.Done()
+			errs[i] = fn(i, t)
+		}(i, t)
+	}
+	wg.Wait()
+
+	var partial = &PartialError{Tenants: len(m.tenants), Errors: make(map[string]error)}
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, ErrNoMetrics) {
+			partial.Errors[m.tenants[i].Name] = err
+		}
+	}
+	if len(partial.Errors) > 0 {
+		return partial
+	}
+	return nil
+}
+
+func tagTenant(tags []string, name string) []string {
+	return append(append([]string(nil), tags...), TenantTagPrefix+name)
+}
+
+// ListMetrics returns the merged metrics of every tenant.
+func (m *MultiTenantClient) ListMetrics(queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	return m.ListMetricsContext(context.Background(), queryString, pluginType, metrics, rollup, windowSize, to)
+}
+
+// ListMetricsContext returns the merged metrics of every tenant. If some tenants fail the items of the
+// others are returned with a *PartialError.
+func (m *MultiTenantClient) ListMetricsContext(ctx context.Context, queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	var results = make([][]openapi.MetricItem, len(m.tenants))
+	err := m.fanOut(func(i int, t Tenant) error {
+		items, err := t.Client.ListMetricsContext(ctx, queryString, pluginType, metrics, rollup, windowSize, to)
+		for j := range items {
+			items[j].Tags = tagTenant(items[j].Tags, t.Name)
+		}
+		results[i] = items
+		return err
+	})
+
+	var merged []openapi.MetricItem
+	for _, items := range results {
+		merged = append(merged, items...)
+	}
+	if err != nil {
+		return merged, err
+	}
+	if len(merged) < 1 {
+		return nil, ErrNoMetrics
+	}
+	return merged, nil
+}
+
+// ListSnapshots returns the merged snapshots of every tenant.
+func (m *MultiTenantClient) ListSnapshots(queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	return m.ListSnapshotsContext(context.Background(), queryString, pluginType, windowSize)
+}
+
+// ListSnapshotsContext returns the merged snapshots of every tenant. If some tenants fail the snapshots
+// of the others are returned with a *PartialError.
+func (m *MultiTenantClient) ListSnapshotsContext(ctx context.Context, queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	var results = make([][]openapi.SnapshotItem, len(m.tenants))
+	err := m.fanOut(func(i int, t Tenant) error {
+		items, err := t.Client.ListSnapshotsContext(ctx, queryString, pluginType, windowSize)
+		for j := range items {
+			items[j].Tags = tagTenant(items[j].Tags, t.Name)
+		}
+		results[i] = items
+		return err
+	})
+
+	var merged []openapi.SnapshotItem
+	for _, items := range results {
+		merged = append(merged, items...)
+	}
+	return merged, err
+}
@@ -0,0 +1,101 @@
+package instana_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+type failingQuery struct {
+	err error
+}
+
+func (f failingQuery) ListMetricsContext(ctx context.Context, queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	return nil, f.err
+}
+
+func (f failingQuery) ListSnapshotsContext(ctx context.Context, queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	return nil, f.err
+}
+
+func Test_MultiTenantClient_ListMetricsContext(t *testing.T) {
+	t.Parallel()
+
+	unavailable := errors.New("unavailable")
+
+	td := map[string]struct {
+		tenants  []instana.Tenant
+		items    map[string]string
+		failed   []string
+		complete bool
+	}{
+		"all succeed": {
+			tenants: []instana.Tenant{
+				{Name: "eu", Client: &pointsPerWindow{snapshots: []string{"a"}}},
+				{Name: "us", Client: &pointsPerWindow{snapshots: []string{"b", "c"}}},
+			},
+			items: map[string]string{"a": "eu", "b": "us", "c": "us"},
+		},
+		"no metrics is not a failure": {
+			tenants: []instana.Tenant{
+				{Name: "eu", Client: &pointsPerWindow{snapshots: []string{"a"}}},
+				{Name: "us", Client: &pointsPerWindow{}},
+			},
+			items: map[string]string{"a": "eu"},
+		},
+		"partial failure": {
+			tenants: []instana.Tenant{
+				{Name: "eu", Client: &pointsPerWindow{snapshots: []string{"a"}}},
+				{Name: "us", Client: failingQuery{unavailable}},
+			},
+			items:  map[string]string{"a": "eu"},
+			failed: []string{"us"},
+		},
+		"complete failure": {
+			tenants: []instana.Tenant{
+				{Name: "eu", Client: failingQuery{unavailable}},
+				{Name: "us", Client: failingQuery{unavailable}},
+			},
+			items:    map[string]string{},
+			failed:   []string{"eu", "us"},
+			complete: true,
+		},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			client := instana.NewMultiTenantClient(tc.tenants...)
+			items, err := client.ListMetricsContext(context.Background(), "", "host", []string{CpuUser}, 1, 60000, 1601553600000)
+
+			var partial *instana.PartialError
+			if len(tc.failed) > 0 {
+				if !errors.As(err, &partial) {
+					t.Fatalf("ListMetricsContext() error = %v, want *PartialError", err)
+				}
+				for _, name := range tc.failed {
+					if !errors.Is(partial.Errors[name], unavailable) {
+						t.Errorf("Errors[%s] = %v, want %v", name, partial.Errors[name], unavailable)
+					}
+				}
+				if partial.Complete() != tc.complete {
+					t.Errorf("Complete() = %v, want %v", partial.Complete(), tc.complete)
+				}
+			} else if err != nil {
+				t.Fatalf("ListMetricsContext() error = %v", err)
+			}
+
+			if len(items) != len(tc.items) {
+				t.Fatalf("len(items) = %v, want %v", len(items), len(tc.items))
+			}
+			for _, item := range items {
+				tenant := instana.TenantOf(item.Tags)
+				if tenant != tc.items[item.SnapshotId] {
+					t.Errorf("TenantOf(%s) = %q, want %q", item.SnapshotId, tenant, tc.items[item.SnapshotId])
+				}
+			}
+		})
+	}
+}
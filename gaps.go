@@ -0,0 +1,244 @@
+package instana
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// Gap is a run of missing points in a series, Start and End are the first and last missing timestamps.
+type Gap struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"`
+	Missing int   `json:"missing"`
+}
+
+// FindGaps returns the gaps between the first and last finite points of a series with points every rollup
+// seconds. Timestamps more than half a rollup late are missing points, as are NaN and infinite values.
+// It returns nil without a positive rollup as the missing timestamps are unknown.
+func FindGaps(s Series, rollup int64) []Gap {
+	var gaps []Gap
+	var step = rollup * 1000
+	var prev int64
+	var found bool
+	for _, p := range s {
+		if !isFinite(p.Value) {
+			continue
+		}
+		if found {
+			if missing := steps(p.Timestamp-prev, step) - 1; missing > 0 {
+				gaps = append(gaps, Gap{Start: prev + step, End: p.Timestamp - step, Missing: missing})
+			}
+		}
+		prev, found = p.Timestamp, true
+	}
+	return gaps
+}
+
+// steps returns the number of rollup steps in d rounded to the nearest step. Without a positive step
+// consecutive points are always one step apart.
+func steps(d int64, step int64) int {
+	if step <= 0 {
+		return 1
+	}
+	return int(math.Round(float64(d) / float64(step)))
+}
+
+// Segments splits the series at gaps and NaN or infinite values, each segment holds consecutive finite
+// points. Charts draw each segment as a separate line so missing data shows as a break rather than a drop.
+// Without a positive rollup the series is only split at NaN and infinite values.
+func (s Series) Segments(rollup int64) []Series {
+	var segments []Series
+	var current Series
+	var step = rollup * 1000
+	for _, p := range s {
+		if !isFinite(p.Value) {
+			if len(current) > 0 {
+				segments = append(segments, current)
+				current = nil
+			}
+			continue
+		}
+		if len(current) > 0 && steps(p.Timestamp-current[len(current)-1].Timestamp, step) > 1 {
+			segments = append(segments, current)
+			current = nil
+		}
+		current = append(current, p)
+	}
+	if len(current) > 0 {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+// FillStrategy fills the missing points of a series.
+type FillStrategy int
+
+const (
+	// FillNone inserts NaN at missing timestamps, which JSON encodes as null and charts draw as a break.
+	FillNone FillStrategy = iota
+	// FillPrevious repeats the last value before the gap.
+	FillPrevious
+	// FillLinear interpolates between the values either side of the gap.
+	FillLinear
+	// FillZero fills the gap with 0.
+	FillZero
+)
+
+// ParseFillStrategy parses "none" (or "null"), "previous", "linear" or "zero".
+func ParseFillStrategy(s string) (FillStrategy, error) {
+	switch s {
+	case "none", "null", "":
+		return FillNone, nil
+	case "previous":
+		return FillPrevious, nil
+	case "linear":
+		return FillLinear, nil
+	case "zero":
+		return FillZero, nil
+	}
+	return FillNone, fmt.Errorf("invalid fill strategy %q, must be one of none, previous, linear or zero", s)
+}
+
+// Fill inserts the missing points between the first and last points of a series with points every rollup
+// seconds and replaces NaN and infinite values using strategy. FillPrevious and FillLinear leave values
+// before the first finite value NaN, as does FillLinear after the last one. Without a positive rollup no
+// points are inserted.
+func Fill(s Series, rollup int64, strategy FillStrategy) Series {
+	var step = rollup * 1000
+	var filled = make(Series, 0, len(s))
+	for i, p := range s {
+		if i > 0 {
+			prev := s[i-1].Timestamp
+			for k := 1; k < steps(p.Timestamp-prev, step); k++ {
+				filled = append(filled, Point{Timestamp: prev + int64(k)*step, Value: math.NaN()})
+			}
+		}
+		filled = append(filled, p)
+	}
+
+	if strategy == FillNone {
+		for i := range filled {
+			if !isFinite(filled[i].Value) {
+				filled[i].Value = math.NaN()
+			}
+		}
+		return filled
+	}
+
+	var last = -1
+	for i := range filled {
+		if isFinite(filled[i].Value) {
+			last = i
+			continue
+		}
+		switch strategy {
+		case FillZero:
+			filled[i].Value = 0
+		case FillPrevious:
+			filled[i].Value = math.NaN()
+			if last >= 0 {
+				filled[i].Value = filled[last].Value
+			}
+		case FillLinear:
+			filled[i].Value = interpolate(filled, last, i)
+		}
+	}
+	return filled
+}
+
+// interpolate returns the value at i on the line between the finite values at prev and the next finite
+// value after i, or NaN if either is missing.
+func interpolate(s Series, prev int, i int) float64 {
+	if prev < 0 {
+		return math.NaN()
+	}
+	for next := i + 1; next < len(s); next++ {
+		if isFinite(s[next].Value) {
+			a, b := s[prev], s[next]
+			return a.Value + (b.Value-a.Value)*float64(s[i].Timestamp-a.Timestamp)/float64(b.Timestamp-a.Timestamp)
+		}
+	}
+	return math.NaN()
+}
+
+// Transform returns the strategy as a Transform for TransformItems.
+func (f FillStrategy) Transform(rollup int64) Transform {
+	return func(s Series) Series { return Fill(s, rollup, f) }
+}
+
+// Completeness reports how much of a snapshot's metric was present in a window.
+type Completeness struct {
+	SnapshotID string `json:"snapshotId"`
+	Label      string `json:"label,omitempty"`
+	Host       string `json:"host,omitempty"`
+	// Expected is the number of points the window should hold at the rollup.
+	Expected int `json:"expected"`
+	// Present is the number of finite points in the window.
+	Present int   `json:"present"`
+	Gaps    []Gap `json:"gaps,omitempty"`
+}
+
+// Ratio returns the fraction of expected points that are present.
+func (c Completeness) Ratio() float64 {
+	if c.Expected == 0 {
+		return 1
+	}
+	return math.Min(float64(c.Present)/float64(c.Expected), 1)
+}
+
+// CompletenessReport returns the completeness of metric for each item in the window from to to (epoch
+// milliseconds, inclusive) at the rollup in seconds. Unlike FindGaps it reports points missing at the start
+// and end of the window. The window is narrowed to the item's From and To if set, so snapshots that
+// started or stopped during the window aren't reported as incomplete. It returns nil without a positive
+// rollup as no points are expected.
+func CompletenessReport(items []openapi.MetricItem, metric string, from int64, to int64, rollup int64) []Completeness {
+	if rollup <= 0 {
+		return nil
+	}
+
+	var report = make([]Completeness, 0, len(items))
+	var step = rollup * 1000
+	for _, item := range items {
+		start, end := from, to
+		if item.From > start {
+			start = item.From
+		}
+		if item.To > 0 && item.To < end {
+			end = item.To
+		}
+
+		c := Completeness{SnapshotID: item.SnapshotId, Label: item.Label, Host: item.Host}
+		if end >= start {
+			c.Expected = int((end-start)/step) + 1
+		}
+
+		var window Series
+		for _, p := range SeriesOf(item, metric) {
+			if p.Timestamp >= start && p.Timestamp <= end && isFinite(p.Value) {
+				window = append(window, p)
+			}
+		}
+		c.Present = len(window)
+
+		if len(window) == 0 {
+			if c.Expected > 0 {
+				c.Gaps = []Gap{{Start: start, End: start + int64(c.Expected-1)*step, Missing: c.Expected}}
+			}
+			report = append(report, c)
+			continue
+		}
+
+		first, last := window[0].Timestamp, window[len(window)-1].Timestamp
+		if missing := int((first - start) / step); missing > 0 {
+			c.Gaps = append(c.Gaps, Gap{Start: first - int64(missing)*step, End: first - step, Missing: missing})
+		}
+		c.Gaps = append(c.Gaps, FindGaps(window, rollup)...)
+		if missing := int((end - last) / step); missing > 0 {
+			c.Gaps = append(c.Gaps, Gap{Start: last + step, End: last + int64(missing)*step, Missing: missing})
+		}
+		report = append(report, c)
+	}
+	return report
+}
@@ -0,0 +1,142 @@
+package instana_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+func Test_FindGaps(t *testing.T) {
+	t.Parallel()
+
+	nan := math.NaN()
+	td := map[string]struct {
+		input    instana.Series
+		rollup   int64
+		expected []instana.Gap
+	}{
+		"complete":        {series([2]float64{0, 1}, [2]float64{1, 2}, [2]float64{2, 3}), 1, nil},
+		"missing point":   {series([2]float64{0, 1}, [2]float64{3, 2}), 1, []instana.Gap{{Start: 1000, End: 2000, Missing: 2}}},
+		"non finite":      {series([2]float64{0, 1}, [2]float64{1, nan}, [2]float64{2, 3}), 1, []instana.Gap{{Start: 1000, End: 1000, Missing: 1}}},
+		"rollup":          {series([2]float64{0, 1}, [2]float64{60, 1}, [2]float64{240, 1}), 60, []instana.Gap{{Start: 120000, End: 180000, Missing: 2}}},
+		"jitter":          {series([2]float64{0, 1}, [2]float64{61, 1}, [2]float64{119, 1}), 60, nil},
+		"leading NaN":     {series([2]float64{0, nan}, [2]float64{1, 1}), 1, nil},
+		"only non finite": {series([2]float64{0, nan}), 1, nil},
+		"zero rollup":     {series([2]float64{0, 1}, [2]float64{3, 2}), 0, nil},
+		"negative rollup": {series([2]float64{0, 1}, [2]float64{1, nan}, [2]float64{3, 2}), -1, nil},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := instana.FindGaps(tc.input, tc.rollup)
+			if !cmp.Equal(actual, tc.expected) {
+				t.Errorf("FindGaps() -got/+want:\n%s", cmp.Diff(actual, tc.expected))
+			}
+		})
+	}
+}
+
+func Test_Fill(t *testing.T) {
+	t.Parallel()
+
+	nan := math.NaN()
+	input := series([2]float64{0, nan}, [2]float64{1, 10}, [2]float64{4, 40}, [2]float64{5, nan}, [2]float64{6, 0})
+	td := map[string]struct {
+		strategy instana.FillStrategy
+		expected instana.Series
+	}{
+		"none":     {instana.FillNone, series([2]float64{0, nan}, [2]float64{1, 10}, [2]float64{2, nan}, [2]float64{3, nan}, [2]float64{4, 40}, [2]float64{5, nan}, [2]float64{6, 0})},
+		"previous": {instana.FillPrevious, series([2]float64{0, nan}, [2]float64{1, 10}, [2]float64{2, 10}, [2]float64{3, 10}, [2]float64{4, 40}, [2]float64{5, 40}, [2]float64{6, 0})},
+		"linear":   {instana.FillLinear, series([2]float64{0, nan}, [2]float64{1, 10}, [2]float64{2, 20}, [2]float64{3, 30}, [2]float64{4, 40}, [2]float64{5, 20}, [2]float64{6, 0})},
+		"zero":     {instana.FillZero, series([2]float64{0, 0}, [2]float64{1, 10}, [2]float64{2, 0}, [2]float64{3, 0}, [2]float64{4, 40}, [2]float64{5, 0}, [2]float64{6, 0})},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := instana.Fill(input, 1, tc.strategy)
+			if !cmp.Equal(actual, tc.expected, cmpopts.EquateNaNs()) {
+				t.Errorf("Fill() -got/+want:\n%s", cmp.Diff(actual, tc.expected, cmpopts.EquateNaNs()))
+			}
+		})
+	}
+
+	expected := series([2]float64{0, nan}, [2]float64{1, 10}, [2]float64{4, 40}, [2]float64{5, 40}, [2]float64{6, 0})
+	actual := instana.Fill(input, 0, instana.FillPrevious)
+	if !cmp.Equal(actual, expected, cmpopts.EquateNaNs()) {
+		t.Errorf("Fill(0) -got/+want:\n%s", cmp.Diff(actual, expected, cmpopts.EquateNaNs()))
+	}
+}
+
+func Test_Segments(t *testing.T) {
+	t.Parallel()
+
+	input := series([2]float64{0, 1}, [2]float64{1, 2}, [2]float64{3, 3}, [2]float64{4, math.NaN()}, [2]float64{5, 4})
+	expected := []instana.Series{
+		series([2]float64{0, 1}, [2]float64{1, 2}),
+		series([2]float64{3, 3}),
+		series([2]float64{5, 4}),
+	}
+
+	actual := input.Segments(1)
+	if !cmp.Equal(actual, expected) {
+		t.Errorf("Segments() -got/+want:\n%s", cmp.Diff(actual, expected))
+	}
+
+	expected = []instana.Series{
+		series([2]float64{0, 1}, [2]float64{1, 2}, [2]float64{3, 3}),
+		series([2]float64{5, 4}),
+	}
+	actual = input.Segments(0)
+	if !cmp.Equal(actual, expected) {
+		t.Errorf("Segments(0) -got/+want:\n%s", cmp.Diff(actual, expected))
+	}
+}
+
+func Test_CompletenessReport(t *testing.T) {
+	t.Parallel()
+
+	items := []openapi.MetricItem{
+		{SnapshotId: "complete", Metrics: map[string][][]float64{CpuUser: {{0, 1}, {1000, 1}, {2000, 1}, {3000, 1}, {4000, 1}}}},
+		{SnapshotId: "gaps", Metrics: map[string][][]float64{CpuUser: {{1000, 1}, {3000, math.NaN()}}}},
+		{SnapshotId: "empty"},
+		{SnapshotId: "started", From: 3000, Metrics: map[string][][]float64{CpuUser: {{3000, 1}, {4000, 1}}}},
+	}
+	expected := []instana.Completeness{
+		{SnapshotID: "complete", Expected: 5, Present: 5},
+		{SnapshotID: "gaps", Expected: 5, Present: 1, Gaps: []instana.Gap{{Start: 0, End: 0, Missing: 1}, {Start: 2000, End: 4000, Missing: 3}}},
+		{SnapshotID: "empty", Expected: 5, Present: 0, Gaps: []instana.Gap{{Start: 0, End: 4000, Missing: 5}}},
+		{SnapshotID: "started", Expected: 2, Present: 2},
+	}
+
+	actual := instana.CompletenessReport(items, CpuUser, 0, 4000, 1)
+	if !cmp.Equal(actual, expected) {
+		t.Errorf("CompletenessReport() -got/+want:\n%s", cmp.Diff(actual, expected))
+	}
+	if ratio := actual[1].Ratio(); ratio != 0.2 {
+		t.Errorf("Ratio() = %v, want 0.2", ratio)
+	}
+	if report := instana.CompletenessReport(items, CpuUser, 0, 4000, 0); report != nil {
+		t.Errorf("CompletenessReport(rollup 0) = %v, want nil", report)
+	}
+}
+
+func Test_ParseFillStrategy(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"none", "null", "previous", "linear", "zero"} {
+		if _, err := instana.ParseFillStrategy(s); err != nil {
+			t.Errorf("ParseFillStrategy(%q) err = %v, want nil", s, err)
+		}
+	}
+	if _, err := instana.ParseFillStrategy("mean"); err == nil {
+		t.Errorf("ParseFillStrategy(mean) err = nil, want error")
+	}
+}
@@ -0,0 +1,165 @@
+package instana
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// NoGroup is the key of the items a GroupKey has no value for.
+const NoGroup = "(none)"
+
+// GroupKey returns the group of an item, or false if the item has no value for the key.
+type GroupKey func(item EnrichedItem) (string, bool)
+
+// ByHost groups items by host.
+func ByHost() GroupKey {
+	return func(item EnrichedItem) (string, bool) {
+		return item.Host, item.Host != ""
+	}
+}
+
+// ByPlugin groups items by plugin.
+func ByPlugin() GroupKey {
+	return func(item EnrichedItem) (string, bool) {
+		return item.Plugin, item.Plugin != ""
+	}
+}
+
+// ByTag groups items by the value of the first tag named prefix, e.g. zone groups the tag zone=us-east-2
+// as us-east-2 but ignores zone_id=1. A tag without a value such as canary is grouped under its name. A
+// trailing = is trimmed so zone and zone= are equivalent.
+func ByTag(prefix string) GroupKey {
+	name := strings.TrimSuffix(prefix, "=")
+	return func(item EnrichedItem) (string, bool) {
+		for _, tag := range item.Tags {
+			if tag == name {
+				return name, true
+			}
+			if strings.HasPrefix(tag, name+"=") {
+				return tag[len(name)+1:], true
+			}
+		}
+		return "", false
+	}
+}
+
+// ByLabel groups items by the first capture group of re in their label, or the whole match if re has no
+// capture groups. For example `^([a-z-]+)-[0-9]+$` groups the pods of a stateful set.
+func ByLabel(re *regexp.Regexp) GroupKey {
+	return func(item EnrichedItem) (string, bool) {
+		m := re.FindStringSubmatch(item.Label)
+		switch {
+		case m == nil:
+			return "", false
+		case len(m) > 1:
+			return m[1], true
+		}
+		return m[0], true
+	}
+}
+
+// ByProperty groups items by a property of their snapshot data, see EnrichMetrics.
+func ByProperty(name string) GroupKey {
+	return func(item EnrichedItem) (string, bool) {
+		v, ok := item.Property(name)
+		if !ok || v == nil {
+			return "", false
+		}
+		return fmt.Sprint(v), true
+	}
+}
+
+// ParseGroupBy parses a group key: host, plugin, tag:<prefix>, label:<regexp> or property:<name>.
+func ParseGroupBy(s string) (GroupKey, error) {
+	kind, arg := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		kind, arg = s[:i], s[i+1:]
+	}
+
+	switch {
+	case kind == "host" && arg == "":
+		return ByHost(), nil
+	case kind == "plugin" && arg == "":
+		return ByPlugin(), nil
+	case kind == "tag" && arg != "":
+		return ByTag(arg), nil
+	case kind == "label" && arg != "":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label pattern %q: %w", arg, err)
+		}
+		return ByLabel(re), nil
+	case kind == "property" && arg != "":
+		return ByProperty(arg), nil
+	}
+	return nil, fmt.Errorf("invalid group by %q, must be one of host, plugin, tag:<prefix>, label:<regexp> or property:<name>", s)
+}
+
+// NeedsSnapshot reports whether the group by expression s reads snapshot properties, in which case the
+// items must be enriched with EnrichMetrics before grouping.
+func NeedsSnapshot(s string) bool {
+	return strings.HasPrefix(s, "property:")
+}
+
+// ItemGroup is a set of items sharing a key.
+type ItemGroup struct {
+	Key   string
+	Items []EnrichedItem
+}
+
+// MetricItems returns the metric items of the group, e.g. for Aggregate or NewHeatmap.
+func (g ItemGroup) MetricItems() []openapi.MetricItem {
+	var items = make([]openapi.MetricItem, len(g.Items))
+	for i, item := range g.Items {
+		items[i] = item.MetricItem
+	}
+	return items
+}
+
+// GroupBy partitions items by key ordered by key, items without a value are grouped under NoGroup.
+func GroupBy(items []EnrichedItem, key GroupKey) []ItemGroup {
+	var byKey = make(map[string][]EnrichedItem)
+	for _, item := range items {
+		k, ok := key(item)
+		if !ok {
+			k = NoGroup
+		}
+		byKey[k] = append(byKey[k], item)
+	}
+
+	var groups = make([]ItemGroup, 0, len(byKey))
+	for k, members := range byKey {
+		groups = append(groups, ItemGroup{Key: k, Items: members})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// Enriched wraps items without snapshot data so they can be grouped by anything but a snapshot property.
+func Enriched(items []openapi.MetricItem) []EnrichedItem {
+	var enriched = make([]EnrichedItem, len(items))
+	for i, item := range items {
+		enriched[i] = EnrichedItem{MetricItem: item}
+	}
+	return enriched
+}
+
+// GroupSeries is the aggregate of a group.
+type GroupSeries struct {
+	Key    string `json:"key"`
+	Series Series `json:"series"`
+}
+
+// AggregateGroups reduces metric across the items of each group with agg, returning one series per group
+// in the order of groups.
+func AggregateGroups(groups []ItemGroup, metric string, agg Aggregator, policy NonFinitePolicy) []GroupSeries {
+	var series = make([]GroupSeries, len(groups))
+	for i, g := range groups {
+		series[i] = GroupSeries{Key: g.Key, Series: Aggregate(g.MetricItems(), metric, agg, policy)}
+	}
+	return series
+}
@@ -0,0 +1,100 @@
+package instana_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+func groupItems() []instana.EnrichedItem {
+	return []instana.EnrichedItem{
+		{
+			MetricItem: openapi.MetricItem{SnapshotId: "a", Host: "host-a", Plugin: "host", Label: "web-0", Tags: []string{"zone=us-east-2", "service=web"}, Metrics: cpuUser(1601553600, []float64{0.2})},
+			Snapshot:   instana.Snapshot{Data: map[string]interface{}{"cpu.count": float64(8)}},
+		},
+		{
+			MetricItem: openapi.MetricItem{SnapshotId: "b", Host: "host-b", Plugin: "host", Label: "web-1", Tags: []string{"zone=us-east-2", "canary"}, Metrics: cpuUser(1601553600, []float64{0.4})},
+			Snapshot:   instana.Snapshot{Data: map[string]interface{}{"cpu.count": float64(4)}},
+		},
+		{
+			MetricItem: openapi.MetricItem{SnapshotId: "c", Host: "host-c", Plugin: "host", Label: "db", Tags: []string{"zone_id=7", "zone=eu-west-1"}, Metrics: cpuUser(1601553600, []float64{0.9})},
+			Snapshot:   instana.Snapshot{Data: map[string]interface{}{"cpu.count": float64(8)}},
+		},
+	}
+}
+
+func Test_GroupBy(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		by       string
+		expected map[string][]string
+	}{
+		"host":              {"host", map[string][]string{"host-a": {"a"}, "host-b": {"b"}, "host-c": {"c"}}},
+		"plugin":            {"plugin", map[string][]string{"host": {"a", "b", "c"}}},
+		"tag":               {"tag:zone", map[string][]string{"us-east-2": {"a", "b"}, "eu-west-1": {"c"}}},
+		"tag with =":        {"tag:zone=", map[string][]string{"us-east-2": {"a", "b"}, "eu-west-1": {"c"}}},
+		"missing tag":       {"tag:service=", map[string][]string{"web": {"a"}, instana.NoGroup: {"b", "c"}}},
+		"sibling tag":       {"tag:zone_id", map[string][]string{"7": {"c"}, instana.NoGroup: {"a", "b"}}},
+		"tag without value": {"tag:canary", map[string][]string{"canary": {"b"}, instana.NoGroup: {"a", "c"}}},
+		"label capture":     {`label:^([a-z]+)-\d+$`, map[string][]string{"web": {"a", "b"}, instana.NoGroup: {"c"}}},
+		"label match":       {"label:web", map[string][]string{"web": {"a", "b"}, instana.NoGroup: {"c"}}},
+		"property":          {"property:cpu.count", map[string][]string{"8": {"a", "c"}, "4": {"b"}}},
+		"missing property":  {"property:hostname", map[string][]string{instana.NoGroup: {"a", "b", "c"}}},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			key, err := instana.ParseGroupBy(tc.by)
+			if err != nil {
+				t.Fatalf("ParseGroupBy(%q) err = %v, want nil", tc.by, err)
+			}
+
+			var actual = make(map[string][]string)
+			var keys []string
+			for _, g := range instana.GroupBy(groupItems(), key) {
+				keys = append(keys, g.Key)
+				for _, item := range g.Items {
+					actual[g.Key] = append(actual[g.Key], item.SnapshotId)
+				}
+			}
+			if !cmp.Equal(actual, tc.expected) {
+				t.Errorf("GroupBy() -got/+want:\n%s", cmp.Diff(actual, tc.expected))
+			}
+			for i := 1; i < len(keys); i++ {
+				if keys[i-1] > keys[i] {
+					t.Errorf("GroupBy() keys = %v, want ascending order", keys)
+				}
+			}
+		})
+	}
+}
+
+func Test_ParseGroupBy_errors(t *testing.T) {
+	t.Parallel()
+
+	for _, by := range []string{"", "zone", "tag:", "host:a", "label:(", "property:"} {
+		if _, err := instana.ParseGroupBy(by); err == nil {
+			t.Errorf("ParseGroupBy(%q) err = nil, want error", by)
+		}
+	}
+}
+
+func Test_AggregateGroups(t *testing.T) {
+	t.Parallel()
+
+	groups := instana.GroupBy(groupItems(), instana.ByTag("zone="))
+	expected := []instana.GroupSeries{
+		{Key: "eu-west-1", Series: instana.Series{{Timestamp: 1601553600000, Value: 0.9}}},
+		{Key: "us-east-2", Series: instana.Series{{Timestamp: 1601553600000, Value: 0.30000000000000004}}},
+	}
+
+	actual := instana.AggregateGroups(groups, CpuUser, instana.AggMean, instana.SkipNonFinite)
+	if !cmp.Equal(actual, expected) {
+		t.Errorf("AggregateGroups() -got/+want:\n%s", cmp.Diff(actual, expected))
+	}
+}
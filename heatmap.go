@@ -0,0 +1,281 @@
+package instana
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+const percentBuckets = 21
+
+// PercentageHeatmap counts the values in [0, 1] at each epoch millisecond timestamp in 5% buckets.
+type PercentageHeatmap map[int64][percentBuckets]int
+
+// Timestamps returns the timestamps of the heatmap in ascending order.
+func (ph PercentageHeatmap) Timestamps() []int64 {
+	var ts = make([]int64, 0, len(ph))
+	for t := range ph {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+	return ts
+}
+
+// Heatmap converts the percentage heatmap to a Heatmap with buckets labelled 0% to 100%.
+func (ph PercentageHeatmap) Heatmap() Heatmap {
+	h := Heatmap{
+		Timestamps: ph.Timestamps(),
+		Edges:      make([]float64, percentBuckets),
+		Max:        1,
+		Format:     func(v float64) string { return fmt.Sprintf("%d%%", int(math.Round(v*100))) },
+	}
+	for i := range h.Edges {
+		h.Edges[i] = float64(i) / (percentBuckets - 1)
+	}
+	for _, ts := range h.Timestamps {
+		hist := ph[ts]
+		h.Counts = append(h.Counts, append([]int(nil), hist[:]...))
+	}
+	return h
+}
+
+// ToPercentageHeatmap buckets metric across items at each timestamp, timestamps are truncated to the second.
+// NaN and infinite values are ignored.
+func ToPercentageHeatmap(items []openapi.MetricItem, metric string) PercentageHeatmap {
+	var ph = make(PercentageHeatmap)
+	for _, column := range columns(items, metric) {
+		var hist [percentBuckets]int
+		for _, value := range column.values {
+			if !isFinite(value) {
+				continue
+			}
+			v := int(math.Floor(value * percentBuckets)) // scale to an index
+			if v == 0 && value > 0 {
+				v = 1
+			}
+			if v > percentBuckets-1 {
+				v = percentBuckets - 1
+			}
+			if v < 0 {
+				v = 0
+			}
+			hist[v]++
+		}
+		ph[column.timestamp] = hist
+	}
+	return ph
+}
+
+// BucketScale spaces the edges of heatmap buckets.
+type BucketScale int
+
+const (
+	// LinearBuckets have equal widths.
+	LinearBuckets BucketScale = iota
+	// LogBuckets have equal widths on a logarithmic scale, suiting values spanning orders of magnitude
+	// such as latencies or memory sizes.
+	LogBuckets
+)
+
+// ParseBucketScale parses "linear" or "log".
+func ParseBucketScale(s string) (BucketScale, error) {
+	switch s {
+	case "linear", "":
+		return LinearBuckets, nil
+	case "log":
+		return LogBuckets, nil
+	}
+	return LinearBuckets, fmt.Errorf("invalid bucket scale %q, must be linear or log", s)
+}
+
+// DefaultHeatmapBuckets is the number of buckets used when HeatmapOptions.Buckets is 0.
+const DefaultHeatmapBuckets = 20
+
+// MaxHeatmapBuckets limits HeatmapOptions.Buckets, each timestamp holds a count per bucket.
+const MaxHeatmapBuckets = 1000
+
+// HeatmapOptions configures NewHeatmap.
+type HeatmapOptions struct {
+	// Buckets is the number of buckets, DefaultHeatmapBuckets if 0 and at most MaxHeatmapBuckets.
+	Buckets int
+	Scale   BucketScale
+	// Min and Max set the range of the buckets if Max is greater than Min, otherwise the range is
+	// detected from the data. Values outside the range are counted in the first or last bucket.
+	Min float64
+	Max float64
+	// Quantile narrows a detected range to the Quantile and 1-Quantile quantiles of the values so a few
+	// outliers don't squash the rest into one bucket, e.g. 0.01. The range spans every value if 0.
+	Quantile float64
+}
+
+// Heatmap counts the values of several series in buckets at each timestamp.
+type Heatmap struct {
+	Timestamps []int64 `json:"timestamps"`
+	// Edges are the lower bounds of the buckets in ascending order.
+	Edges []float64 `json:"edges"`
+	// Max is the upper bound of the last bucket.
+	Max float64 `json:"max"`
+	// Counts holds the bucket counts of each timestamp.
+	Counts [][]int `json:"counts"`
+	// Format labels the buckets by their lower bound, FormatValue if nil.
+	Format func(float64) string `json:"-"`
+}
+
+// NewHeatmap buckets metric across items at each timestamp, timestamps are truncated to the second.
+// NaN and infinite values are ignored.
+func NewHeatmap(items []openapi.MetricItem, metric string, opts HeatmapOptions) (Heatmap, error) {
+	if opts.Buckets == 0 {
+		opts.Buckets = DefaultHeatmapBuckets
+	}
+	if opts.Buckets < 1 || opts.Buckets > MaxHeatmapBuckets {
+		return Heatmap{}, fmt.Errorf("invalid bucket count %d, must be in [1, %d]", opts.Buckets, MaxHeatmapBuckets)
+	}
+	if !(opts.Quantile >= 0 && opts.Quantile < 0.5) {
+		return Heatmap{}, fmt.Errorf("invalid quantile %v, must be in [0, 0.5)", opts.Quantile)
+	}
+	if !isFinite(opts.Min) || !isFinite(opts.Max) {
+		return Heatmap{}, fmt.Errorf("invalid range [%v, %v], min and max must be finite", opts.Min, opts.Max)
+	}
+
+	cols := columns(items, metric)
+	lo, hi := opts.Min, opts.Max
+	if hi <= lo {
+		lo, hi = detectRange(cols, opts)
+	}
+	if opts.Scale == LogBuckets && lo <= 0 {
+		return Heatmap{}, errors.New("logarithmic buckets require a positive minimum")
+	}
+
+	h := Heatmap{Edges: make([]float64, opts.Buckets), Max: hi}
+	for i := range h.Edges {
+		h.Edges[i] = bucketEdge(lo, hi, i, opts)
+	}
+	for _, column := range cols {
+		counts := make([]int, opts.Buckets)
+		for _, v := range column.values {
+			if isFinite(v) {
+				counts[bucketIndex(lo, hi, v, opts)]++
+			}
+		}
+		h.Timestamps = append(h.Timestamps, column.timestamp)
+		h.Counts = append(h.Counts, counts)
+	}
+	return h, nil
+}
+
+// detectRange returns the range of the finite values trimmed to the configured quantiles. Log scales
+// start at the smallest positive value.
+func detectRange(cols []column, opts HeatmapOptions) (float64, float64) {
+	var values []float64
+	for _, column := range cols {
+		for _, v := range column.values {
+			if isFinite(v) && (opts.Scale != LogBuckets || v > 0) {
+				values = append(values, v)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return 0, 1
+	}
+
+	lo := percentile(values, opts.Quantile*100)
+	hi := percentile(values, (1-opts.Quantile)*100)
+	if hi <= lo {
+		if opts.Scale == LogBuckets {
+			return lo / 2, lo * 2
+		}
+		return lo - 0.5, lo + 0.5
+	}
+	return lo, hi
+}
+
+func bucketEdge(lo float64, hi float64, i int, opts HeatmapOptions) float64 {
+	f := float64(i) / float64(opts.Buckets)
+	if opts.Scale == LogBuckets {
+		return math.Exp(math.Log(lo) + f*(math.Log(hi)-math.Log(lo)))
+	}
+	return lo + f*(hi-lo)
+}
+
+func bucketIndex(lo float64, hi float64, v float64, opts HeatmapOptions) int {
+	var f float64
+	switch {
+	case v <= lo:
+		return 0
+	case opts.Scale == LogBuckets:
+		f = (math.Log(v) - math.Log(lo)) / (math.Log(hi) - math.Log(lo))
+	default:
+		f = (v - lo) / (hi - lo)
+	}
+
+	// f is NaN if the range overflows, e.g. -MaxFloat64 to MaxFloat64
+	i := int(f * float64(opts.Buckets))
+	if i < 0 || math.IsNaN(f) {
+		i = 0
+	}
+	if i >= opts.Buckets {
+		i = opts.Buckets - 1
+	}
+	return i
+}
+
+// Labels returns the label of each bucket.
+func (h Heatmap) Labels() []string {
+	format := h.Format
+	if format == nil {
+		format = FormatValue
+	}
+	var labels = make([]string, len(h.Edges))
+	for i, e := range h.Edges {
+		labels[i] = format(e)
+	}
+	return labels
+}
+
+// FormatValue formats v with three significant digits and an SI suffix for large values, e.g. 0.25, 512,
+// 1.5k or 2.15G.
+func FormatValue(v float64) string {
+	suffixes := []string{"", "k", "M", "G", "T", "P"}
+	// round first so 999999.9999 becomes 1M rather than 1e+03k
+	v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 3, 64), 64)
+	var i int
+	for math.Abs(v) >= 1000 && i < len(suffixes)-1 {
+		v /= 1000
+		i++
+	}
+	return strconv.FormatFloat(v, 'g', 3, 64) + suffixes[i]
+}
+
+const (
+	hoursMinutesSeconds = "15:04:05"
+	dateHoursMinutes    = "01-02 15:04:05"
+)
+
+// ToTabular flattens the heatmap into group, variable and value rows ordered by timestamp. Groups are
+// labelled with the clock time, including the date if the heatmap spans more than a day, and variables
+// with the lower bound of the bucket.
+func ToTabular(h Heatmap) [][]string {
+	var tab = [][]string{{"group", "variable", "value"}}
+	var labels = h.Labels()
+	for i, ts := range h.Timestamps {
+		l := timeLabel(ts, h.Timestamps)
+		for j, v := range h.Counts[i] {
+			tab = append(tab, []string{l, labels[j], strconv.Itoa(v)})
+		}
+	}
+	return tab
+}
+
+// timeLabel formats ts with the clock time, adding the date if the ordered timestamps span more than a day.
+func timeLabel(ts int64, timestamps []int64) string {
+	layout := hoursMinutesSeconds
+	if len(timestamps) > 0 && timestamps[len(timestamps)-1]-timestamps[0] >= int64(24*time.Hour/time.Millisecond) {
+		layout = dateHoursMinutes
+	}
+	return Point{Timestamp: ts}.Time().Format(layout)
+}
@@ -0,0 +1,123 @@
+package instana_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_NewHeatmap(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		values []float64
+		opts   instana.HeatmapOptions
+		edges  []float64
+		counts []int
+	}{
+		"detected range":   {[]float64{0, 1, 2, 3, 4}, instana.HeatmapOptions{Buckets: 4}, []float64{0, 1, 2, 3}, []int{1, 1, 1, 2}},
+		"explicit range":   {[]float64{-1, 5, 10, 20}, instana.HeatmapOptions{Buckets: 2, Min: 0, Max: 10}, []float64{0, 5}, []int{1, 3}},
+		"log scale":        {[]float64{1, 5, 10, 50, 100}, instana.HeatmapOptions{Buckets: 2, Scale: instana.LogBuckets}, []float64{1, 10}, []int{2, 3}},
+		"log non positive": {[]float64{0, -1, 10, 1000}, instana.HeatmapOptions{Buckets: 2, Scale: instana.LogBuckets}, []float64{10, 100}, []int{3, 1}},
+		"quantile":         {[]float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 1000}, instana.HeatmapOptions{Buckets: 2, Quantile: 0.1}, []float64{10, 50}, []int{5, 6}},
+		"constant":         {[]float64{3, 3}, instana.HeatmapOptions{Buckets: 2}, []float64{2.5, 3}, []int{0, 2}},
+		"non finite":       {[]float64{math.NaN(), 1, math.Inf(1), 2}, instana.HeatmapOptions{Buckets: 2}, []float64{1, 1.5}, []int{1, 1}},
+		"default buckets":  {[]float64{0, 1}, instana.HeatmapOptions{}, nil, nil},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			h, err := instana.NewHeatmap(column(tc.values...), CpuUser, tc.opts)
+			if err != nil {
+				t.Fatalf("NewHeatmap() err = %v, want nil", err)
+			}
+			if tc.edges == nil {
+				if len(h.Edges) != instana.DefaultHeatmapBuckets {
+					t.Errorf("len(Edges) = %v, want %v", len(h.Edges), instana.DefaultHeatmapBuckets)
+				}
+				return
+			}
+			if !cmp.Equal(h.Edges, tc.edges, cmpopts.EquateApprox(0, 1e-9)) {
+				t.Errorf("Edges -got/+want:\n%s", cmp.Diff(h.Edges, tc.edges))
+			}
+			if len(h.Counts) != 1 || !cmp.Equal(h.Counts[0], tc.counts) {
+				t.Errorf("Counts = %v, want [%v]", h.Counts, tc.counts)
+			}
+		})
+	}
+}
+
+func Test_NewHeatmap_errors(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]instana.HeatmapOptions{
+		"negative buckets":     {Buckets: -1},
+		"quantile too large":   {Quantile: 0.5},
+		"log negative minimum": {Scale: instana.LogBuckets, Min: -1, Max: 10},
+		"too many buckets":     {Buckets: instana.MaxHeatmapBuckets + 1},
+		"NaN quantile":         {Quantile: math.NaN()},
+		"NaN max":              {Max: math.NaN()},
+		"infinite min":         {Min: math.Inf(-1), Max: 10},
+	}
+
+	for name, opts := range td {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := instana.NewHeatmap(column(1, 2), CpuUser, opts)
+			if err == nil {
+				t.Errorf("NewHeatmap(%+v) err = nil, want error", opts)
+			}
+		})
+	}
+}
+
+func Test_ToTabular_value_labels(t *testing.T) {
+	t.Parallel()
+
+	h, err := instana.NewHeatmap(column(1e6, 1e9), CpuUser, instana.HeatmapOptions{Buckets: 3, Scale: instana.LogBuckets})
+	if err != nil {
+		t.Fatalf("NewHeatmap() err = %v, want nil", err)
+	}
+
+	expected := [][]string{
+		{"group", "variable", "value"},
+		{"12:00:00", "1M", "1"},
+		{"12:00:00", "10M", "0"},
+		{"12:00:00", "100M", "1"},
+	}
+	if tab := instana.ToTabular(h); !cmp.Equal(tab, expected) {
+		t.Errorf("ToTabular() -got/+want:\n%s", cmp.Diff(tab, expected))
+	}
+}
+
+func Test_FormatValue(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		value    float64
+		expected string
+	}{
+		"fraction": {0.25, "0.25"},
+		"small":    {512, "512"},
+		"kilo":     {1500, "1.5k"},
+		"giga":     {2147483648, "2.15G"},
+		"negative": {-2000, "-2k"},
+		"zero":     {0, "0"},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if actual := instana.FormatValue(tc.value); actual != tc.expected {
+				t.Errorf("FormatValue(%v) = %q, want %q", tc.value, actual, tc.expected)
+			}
+		})
+	}
+}
@@ -84,6 +84,32 @@ function heatmap(url, div, count) {
     }
 }
 
+// groupHeatmaps draws a heatmap of metric for each group of the entity's snapshots in the container, adding
+// a column per group as groups appear. by is a group by expression such as tag:zone or label:<regexp>.
+function groupHeatmaps(entity, metric, by, container) {
+    let query = "entity=" + encodeURIComponent(entity) + "&metric=" + encodeURIComponent(metric) + "&by=" + encodeURIComponent(by);
+    let columns = {};
+    return function() {
+        d3.json("groups?" + query, function(groups) {
+            (groups || []).forEach(function(g, i) {
+                if (!columns[g.key]) {
+                    let id = container.substring(1) + "_" + Object.keys(columns).length;
+                    let column = d3.select(container)
+                        .append("div")
+                        .attr("class", "column");
+                    let title = column.append("h2");
+                    title.append("span").text(g.key + " (");
+                    title.append("span").attr("id", id + "_count");
+                    title.append("span").text(" snapshots)");
+                    column.append("div").attr("id", id);
+                    columns[g.key] = heatmap("heatmap_data?" + query + "&key=" + encodeURIComponent(g.key), "#" + id, "#" + id + "_count");
+                }
+                columns[g.key]();
+            });
+        });
+    };
+}
+
 function onResizeInterval(fn, interval) {
     fn();
     window.addEventListener('resize', fn);
@@ -98,19 +124,18 @@ function spark(url, id) {
             const DATA_COUNT = data.values.length;
             const BAR_WIDTH = (WIDTH - DATA_COUNT) / DATA_COUNT;
             const x = d3.scaleLinear().domain([0, DATA_COUNT]).range([0, WIDTH]);
-            const y = d3.scaleLinear().domain([0, d3.max(data.values)]).range([HEIGHT, 0]);
+            const y = d3.scaleLinear().domain([0, data.stats.max || 0]).range([HEIGHT, 0]);
 
-            let pctl99 = Math.round(d3.quantile(data.values, 0.99));
+            // summary statistics are computed by the server, null when there is no data.
+            const format = v => v === null || v === undefined ? "-" : Math.round(v);
             d3.select(id + "99")
-                .text(pctl99);
+                .text(format(data.stats.p99));
 
-            let last = Math.round(data.values[data.values.length - 1]);
             d3.select(id + "Last")
-                .text(last);
+                .text(format(data.stats.last));
 
-            let max = Math.round(d3.max(data.values));
             d3.select(id + "Max")
-                .text(max);
+                .text(format(data.stats.max));
 
             d3.select(id)
                 .select("svg")
@@ -124,9 +149,9 @@ function spark(url, id) {
                 .append("rect")
                 .attr("class", "bar")
                 .attr("x", (d, i) => x(i))
-                .attr("y", d => HEIGHT - y(d))
+                .attr("y", d => HEIGHT - y(d || 0))
                 .attr("width", BAR_WIDTH)
-                .attr("height", d => y(d))
+                .attr("height", d => y(d || 0))
                 .attr("fill", "#ccc");
         });
     };
@@ -139,9 +164,9 @@ function main() {
     let cpuUser = heatmap("heatmap_data?metric=cpu.user&entity=host", "#g_cpu_user", "#g_cpu_user_count");
     let cpuWait = heatmap("heatmap_data?metric=cpu.wait&entity=host", "#g_cpu_wait", "#g_cpu_wait_count");
     let fillerDropping = heatmap("heatmap_data?metric=metrics.gauges.KPI.incoming.raw_messages.error_rate&entity=filler", "#g_filler_dropping", "#g_filler_dropping_count");
-    let fillerSpark = spark("ts_sum?entity=filler&metric=metrics.gauges.com.instana.filler.service.snapshot.OnlineSnapshotsLimit.online-snapshots-count", "#sparkFiller");
-    let adProcessorSpark = spark("ts_sum?entity=appdataProcessor&metric=metrics.meters.KPI.incoming.span_messages.calls", "#sparkProcessor");
-    let adWriterSpark = spark("ts_sum?entity=appdataWriter&metric=metrics.meters.KPI.incoming.raw_spans.calls", "#sparkWriter");
+    let fillerSpark = spark("aggregate?agg=sum&entity=filler&metric=metrics.gauges.com.instana.filler.service.snapshot.OnlineSnapshotsLimit.online-snapshots-count", "#sparkFiller");
+    let adProcessorSpark = spark("aggregate?agg=sum&transform=rate&entity=appdataProcessor&metric=metrics.meters.KPI.incoming.span_messages.calls", "#sparkProcessor");
+    let adWriterSpark = spark("aggregate?agg=sum&transform=rate&entity=appdataWriter&metric=metrics.meters.KPI.incoming.raw_spans.calls", "#sparkWriter");
 
     onResizeInterval(fillerSpark, 250);
     onResizeInterval(adProcessorSpark, 250);
@@ -152,6 +177,7 @@ function main() {
     onResizeInterval(cpuUser, 250);
     onResizeInterval(cpuWait, 250);
     onResizeInterval(fillerDropping, 250);
+    onResizeInterval(groupHeatmaps("host", "cpu.user", "tag:zone", "#g_cpu_user_zones"), 1000);
 }
 
 main();
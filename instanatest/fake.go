@@ -0,0 +1,363 @@
+// Package instanatest provides an in-memory fake of the Instana infrastructure API and synthetic series
+// generators for testing code built on instana.InfraQuery without a tenant.
+package instanatest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// Snapshot is a programmable snapshot. The Metrics generators produce the series returned for each metric
+// and Data is returned by GetSnapshotContext.
+type Snapshot struct {
+	openapi.SnapshotItem
+	Data    map[string]interface{}
+	Metrics map[string]Generator
+}
+
+// Call records the arguments of a call to the fake. Metrics and Rollup are empty for snapshot calls and
+// Query holds the snapshot ID for GetSnapshot and ListRelatedHosts calls.
+type Call struct {
+	Method     string
+	Query      string
+	Plugin     string
+	Metrics    []string
+	Rollup     int64
+	WindowSize int64
+	To         int64
+}
+
+// hostPlugin is the plugin of host snapshots, the roots of the fake's view tree.
+const hostPlugin = "host"
+
+// Fake is an in-memory InfraQuery. Snapshots are selected by plugin, the Dynamic Focus query is recorded
+// but not evaluated. It is safe for concurrent use.
+type Fake struct {
+	mu        sync.Mutex
+	snapshots []Snapshot
+	calls     []Call
+	maxCalls  int
+	errs      []error
+	now       func() time.Time
+}
+
+var _ instana.InfraQuery = (*Fake)(nil)
+var _ instana.InfraQueryContext = (*Fake)(nil)
+var _ instana.InfraCatalog = (*Fake)(nil)
+var _ instana.SnapshotGetter = (*Fake)(nil)
+var _ instana.InfraTopology = (*Fake)(nil)
+
+// NewFake returns a fake serving snapshots.
+func NewFake(snapshots ...Snapshot) *Fake {
+	return &Fake{
+		snapshots: snapshots,
+		maxCalls:  -1,
+		now:       time.Now,
+	}
+}
+
+// AddSnapshot adds s to the snapshots served by the fake.
+func (f *Fake) AddSnapshot(s Snapshot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshots = append(f.snapshots, s)
+}
+
+// FailNext queues errors returned by the following calls in order, a nil error lets the call succeed.
+func (f *Fake) FailNext(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, errs...)
+}
+
+// SetNow sets the clock used for calls with a to of 0.
+func (f *Fake) SetNow(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = func() time.Time { return now }
+}
+
+// SetMaxCalls keeps only the n most recent calls, a negative n keeps every call which is the default.
+func (f *Fake) SetMaxCalls(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxCalls = n
+	f.trimCalls()
+}
+
+// Calls returns the calls received so far, or the most recent if limited by SetMaxCalls.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// ListSnapshots returns the snapshots for pluginType.
+func (f *Fake) ListSnapshots(queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	return f.ListSnapshotsContext(context.Background(), queryString, pluginType, windowSize)
+}
+
+// ListSnapshotsContext returns the snapshots for pluginType.
+func (f *Fake) ListSnapshotsContext(ctx context.Context, queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.record(ctx, Call{
+		Method:     "ListSnapshots",
+		Query:      queryString,
+		Plugin:     pluginType,
+		WindowSize: windowSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var items []openapi.SnapshotItem
+	for _, s := range f.snapshots {
+		if s.Plugin == pluginType {
+			items = append(items, s.SnapshotItem)
+		}
+	}
+	return items, nil
+}
+
+// GetSnapshotContext returns the snapshot with id, an unknown id returns an error matching instana.ErrNotFound.
+func (f *Fake) GetSnapshotContext(ctx context.Context, id string) (instana.Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.record(ctx, Call{Method: "GetSnapshot", Query: id})
+	if err != nil {
+		return instana.Snapshot{}, err
+	}
+
+	for _, s := range f.snapshots {
+		if s.SnapshotId == id {
+			return instana.Snapshot{SnapshotItem: s.SnapshotItem, Data: s.Data}, nil
+		}
+	}
+	return instana.Snapshot{}, fmt.Errorf("snapshot %s: %w", id, instana.ErrNotFound)
+}
+
+// ListMetrics returns the generated metrics of the snapshots for pluginType.
+func (f *Fake) ListMetrics(queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	return f.ListMetricsContext(context.Background(), queryString, pluginType, metrics, rollup, windowSize, to)
+}
+
+// ListMetricsContext returns the generated metrics of the snapshots for pluginType. Like the API it
+// rejects calls over instana.MaxPointsPerCall points and returns instana.ErrNoMetrics when nothing matches.
+func (f *Fake) ListMetricsContext(ctx context.Context, queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.record(ctx, Call{
+		Method:     "ListMetrics",
+		Query:      queryString,
+		Plugin:     pluginType,
+		Metrics:    append([]string(nil), metrics...),
+		Rollup:     rollup,
+		WindowSize: windowSize,
+		To:         to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = instana.ValidateRollup(rollup)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", instana.ErrInvalidQuery, err)
+	}
+	if windowSize/1000/rollup > instana.MaxPointsPerCall {
+		return nil, fmt.Errorf("%w: window of %dms exceeds %d points at %ds rollup", instana.ErrInvalidQuery, windowSize, instana.MaxPointsPerCall, rollup)
+	}
+
+	if to <= 0 {
+		to = f.now().UnixNano() / int64(time.Millisecond)
+	}
+	from := to - windowSize
+
+	var items []openapi.MetricItem
+	for _, s := range f.snapshots {
+		if s.Plugin != pluginType {
+			continue
+		}
+		var series = make(map[string][][]float64)
+		for _, name := range metrics {
+			g, ok := s.Metrics[name]
+			if !ok {
+				continue
+			}
+			series[name] = Points(g, from, to, rollup)
+		}
+		if len(series) < 1 {
+			continue
+		}
+		items = append(items, openapi.MetricItem{
+			SnapshotId: s.SnapshotId,
+			Plugin:     s.Plugin,
+			From:       from,
+			To:         to,
+			Tags:       s.Tags,
+			Label:      s.Label,
+			Host:       s.Host,
+			Metrics:    series,
+		})
+	}
+
+	if len(items) < 1 {
+		return nil, instana.ErrNoMetrics
+	}
+	return items, nil
+}
+
+// ListPluginsContext returns the plugins of the fake's snapshots.
+func (f *Fake) ListPluginsContext(ctx context.Context) ([]openapi.PluginResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.record(ctx, Call{Method: "ListPlugins"})
+	if err != nil {
+		return nil, err
+	}
+
+	var seen = make(map[string]bool)
+	var plugins []openapi.PluginResult
+	for _, s := range f.snapshots {
+		if !seen[s.Plugin] {
+			seen[s.Plugin] = true
+			plugins = append(plugins, openapi.PluginResult{Plugin: s.Plugin, Label: s.Plugin})
+		}
+	}
+	return plugins, nil
+}
+
+// ListCatalogMetricsContext returns the metrics generated by the fake's snapshots for plugin.
+func (f *Fake) ListCatalogMetricsContext(ctx context.Context, plugin string) ([]openapi.MetricInstance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.record(ctx, Call{Method: "ListCatalogMetrics", Plugin: plugin})
+	if err != nil {
+		return nil, err
+	}
+
+	var seen = make(map[string]bool)
+	var names []string
+	for _, s := range f.snapshots {
+		if s.Plugin != plugin {
+			continue
+		}
+		for name := range s.Metrics {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var metrics []openapi.MetricInstance
+	for _, name := range names {
+		metrics = append(metrics, openapi.MetricInstance{MetricId: name, PluginId: plugin, Label: name})
+	}
+	return metrics, nil
+}
+
+// ListSearchFieldsContext returns no search fields as the fake does not evaluate queries.
+func (f *Fake) ListSearchFieldsContext(ctx context.Context) ([]openapi.SearchFieldResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return nil, f.record(ctx, Call{Method: "ListSearchFields"})
+}
+
+// GetViewTreeContext returns a tree with a node for each host snapshot containing the other snapshots
+// on the same host, snapshots without a host snapshot are roots.
+func (f *Fake) GetViewTreeContext(ctx context.Context) ([]openapi.TreeNode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.record(ctx, Call{Method: "GetViewTree"})
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts = make(map[string]int)
+	var tree []openapi.TreeNode
+	for _, s := range f.snapshots {
+		if s.Plugin == hostPlugin {
+			hosts[s.Host] = len(tree)
+			tree = append(tree, openapi.TreeNode{SnapshotId: s.SnapshotId, Type: s.Plugin})
+		}
+	}
+	for _, s := range f.snapshots {
+		if s.Plugin == hostPlugin {
+			continue
+		}
+		node := openapi.TreeNode{SnapshotId: s.SnapshotId, Type: s.Plugin}
+		if i, ok := hosts[s.Host]; ok {
+			tree[i].Children = append(tree[i].Children, node)
+		} else {
+			tree = append(tree, node)
+		}
+	}
+	return tree, nil
+}
+
+// ListRelatedHostsContext returns the host snapshots sharing the host of snapshotID.
+func (f *Fake) ListRelatedHostsContext(ctx context.Context, snapshotID string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.record(ctx, Call{Method: "ListRelatedHosts", Query: snapshotID})
+	if err != nil {
+		return nil, err
+	}
+
+	var host string
+	var found bool
+	for _, s := range f.snapshots {
+		if s.SnapshotId == snapshotID {
+			host, found = s.Host, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("snapshot %s: %w", snapshotID, instana.ErrNotFound)
+	}
+
+	var hosts = []string{}
+	for _, s := range f.snapshots {
+		if s.Plugin == hostPlugin && s.Host == host && s.SnapshotId != snapshotID {
+			hosts = append(hosts, s.SnapshotId)
+		}
+	}
+	return hosts, nil
+}
+
+// record appends call and returns the context error or the next queued error. The caller holds the lock.
+func (f *Fake) record(ctx context.Context, call Call) error {
+	f.calls = append(f.calls, call)
+	f.trimCalls()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return nil
+}
+
+// trimCalls drops the oldest calls over maxCalls. The caller holds the lock.
+func (f *Fake) trimCalls() {
+	if f.maxCalls >= 0 && len(f.calls) > f.maxCalls {
+		f.calls = append(f.calls[:0], f.calls[len(f.calls)-f.maxCalls:]...)
+	}
+}
@@ -0,0 +1,127 @@
+package instanatest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/instanatest"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+func newFake() *instanatest.Fake {
+	return instanatest.NewFake(
+		instanatest.Snapshot{
+			SnapshotItem: openapi.SnapshotItem{SnapshotId: "a", Plugin: "host", Label: "host-a"},
+			Metrics:      map[string]instanatest.Generator{"cpu.user": instanatest.Constant(0.5)},
+		},
+		instanatest.Snapshot{
+			SnapshotItem: openapi.SnapshotItem{SnapshotId: "b", Plugin: "docker"},
+			Metrics:      map[string]instanatest.Generator{"cpu.user": instanatest.Constant(0.1)},
+		},
+	)
+}
+
+func Test_Fake_ListMetricsContext(t *testing.T) {
+	t.Parallel()
+
+	fake := newFake()
+	items, err := fake.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{"cpu.user"}, 1, 2000, 1601553600000)
+	if err != nil {
+		t.Fatalf("ListMetricsContext() error = %v", err)
+	}
+
+	expected := []openapi.MetricItem{{
+		SnapshotId: "a",
+		Plugin:     "host",
+		Label:      "host-a",
+		From:       1601553598000,
+		To:         1601553600000,
+		Metrics: map[string][][]float64{
+			"cpu.user": {{1601553598000, 0.5}, {1601553599000, 0.5}, {1601553600000, 0.5}},
+		},
+	}}
+	if !cmp.Equal(items, expected) {
+		t.Errorf("ListMetricsContext() diff: %v", cmp.Diff(items, expected))
+	}
+
+	calls := []instanatest.Call{{
+		Method:     "ListMetrics",
+		Query:      "entity.zone:test",
+		Plugin:     "host",
+		Metrics:    []string{"cpu.user"},
+		Rollup:     1,
+		WindowSize: 2000,
+		To:         1601553600000,
+	}}
+	if !cmp.Equal(fake.Calls(), calls) {
+		t.Errorf("Calls() diff: %v", cmp.Diff(fake.Calls(), calls))
+	}
+}
+
+func Test_Fake_SetMaxCalls(t *testing.T) {
+	t.Parallel()
+
+	fake := newFake()
+	fake.SetMaxCalls(2)
+	for _, id := range []string{"a", "b", "c"} {
+		_, _ = fake.GetSnapshotContext(context.Background(), id)
+	}
+
+	calls := []instanatest.Call{{Method: "GetSnapshot", Query: "b"}, {Method: "GetSnapshot", Query: "c"}}
+	if !cmp.Equal(fake.Calls(), calls) {
+		t.Errorf("Calls() diff: %v", cmp.Diff(fake.Calls(), calls))
+	}
+
+	fake.SetMaxCalls(0)
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("Calls() = %v, want none", calls)
+	}
+}
+
+func Test_Fake_errors(t *testing.T) {
+	t.Parallel()
+
+	unavailable := errors.New("unavailable")
+
+	td := map[string]struct {
+		plugin   string
+		metric   string
+		rollup   int64
+		window   int64
+		fail     error
+		expected error
+	}{
+		"queued error":       {"host", "cpu.user", 1, 60000, unavailable, unavailable},
+		"no matching plugin": {"jvm", "cpu.user", 1, 60000, nil, instana.ErrNoMetrics},
+		"no matching metric": {"host", "cpu.sys", 1, 60000, nil, instana.ErrNoMetrics},
+		"invalid rollup":     {"host", "cpu.user", 2, 60000, nil, instana.ErrInvalidQuery},
+		"too many points":    {"host", "cpu.user", 1, 3600000, nil, instana.ErrInvalidQuery},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			fake := newFake()
+			fake.FailNext(tc.fail)
+			_, err := fake.ListMetricsContext(context.Background(), "", tc.plugin, []string{tc.metric}, tc.rollup, tc.window, 1601553600000)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("ListMetricsContext() error = %v, want %v", err, tc.expected)
+			}
+		})
+	}
+}
+
+func Test_Fake_ListSnapshotsContext(t *testing.T) {
+	t.Parallel()
+
+	fake := newFake()
+	items, err := fake.ListSnapshotsContext(context.Background(), "", "docker", 60000)
+	if err != nil {
+		t.Fatalf("ListSnapshotsContext() error = %v", err)
+	}
+	if len(items) != 1 || items[0].SnapshotId != "b" {
+		t.Errorf("ListSnapshotsContext() = %v, want snapshot b", items)
+	}
+}
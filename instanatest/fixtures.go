@@ -0,0 +1,151 @@
+package instanatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// Fixtures is the data served by Handler, normally loaded from a JSON file with LoadFixtures.
+type Fixtures struct {
+	Snapshots      []FixtureSnapshot                   `json:"snapshots"`
+	Plugins        []openapi.PluginResult              `json:"plugins"`
+	CatalogMetrics map[string][]openapi.MetricInstance `json:"catalogMetrics"`
+	SearchFields   []openapi.SearchFieldResult         `json:"searchFields"`
+}
+
+// FixtureSnapshot is a snapshot with its raw data and metric series.
+type FixtureSnapshot struct {
+	openapi.SnapshotItem
+	Data    map[string]interface{}   `json:"data,omitempty"`
+	Metrics map[string]FixtureSeries `json:"metrics,omitempty"`
+}
+
+// FixtureSeries is a metric series in a fixture file. It is either an array of recorded [timestamp, value]
+// points or a generator spec accepted by ParseGenerator such as "sine 0.5 0.2 1h".
+type FixtureSeries struct {
+	Generator
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *FixtureSeries) UnmarshalJSON(b []byte) error {
+	var spec string
+	if err := json.Unmarshal(b, &spec); err == nil {
+		s.Generator, err = ParseGenerator(spec)
+		return err
+	}
+
+	var points [][]float64
+	err := json.Unmarshal(b, &points)
+	if err != nil {
+		return fmt.Errorf("series must be a generator spec or an array of points: %w", err)
+	}
+	s.Generator = Recorded(points)
+	return nil
+}
+
+// LoadFixtures reads fixtures from the JSON file at path.
+func LoadFixtures(path string) (Fixtures, error) {
+	var fixtures Fixtures
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fixtures, err
+	}
+	err = json.Unmarshal(b, &fixtures)
+	if err != nil {
+		return fixtures, fmt.Errorf("invalid fixtures %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+// Recorded returns the value of the point at exactly ts, series have no points between the recorded ones.
+func Recorded(points [][]float64) Generator {
+	var values = make(map[int64]float64, len(points))
+	for _, p := range points {
+		if len(p) == 2 {
+			values[int64(p[0])] = p[1]
+		}
+	}
+	return func(ts int64) (float64, bool) {
+		v, ok := values[ts]
+		return v, ok
+	}
+}
+
+// ParseGenerator builds a generator from a space separated spec. Durations use time.ParseDuration and
+// timestamps are epoch ms. The supported specs are:
+//
+//	constant VALUE
+//	sine MEAN AMPLITUDE PERIOD
+//	diurnal LOW HIGH
+//	step BEFORE AFTER TIMESTAMP
+//	counter RATE RESET
+func ParseGenerator(spec string) (Generator, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 1 {
+		return nil, fmt.Errorf("empty generator spec")
+	}
+
+	var args = map[string]int{"constant": 1, "sine": 3, "diurnal": 2, "step": 3, "counter": 2}
+	n, ok := args[fields[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q", fields[0])
+	}
+	if len(fields)-1 != n {
+		return nil, fmt.Errorf("generator %q requires %d arguments, got %d", fields[0], n, len(fields)-1)
+	}
+
+	var p = specParser{fields: fields[1:]}
+	var g Generator
+	switch fields[0] {
+	case "constant":
+		g = Constant(p.float(0))
+	case "sine":
+		g = Sine(p.float(0), p.float(1), p.duration(2))
+	case "diurnal":
+		g = Diurnal(p.float(0), p.float(1))
+	case "step":
+		g = Step(p.float(0), p.float(1), p.int(2))
+	case "counter":
+		g = Counter(p.float(0), p.duration(1))
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid generator spec %q: %w", spec, p.err)
+	}
+	return g, nil
+}
+
+// specParser converts spec arguments keeping the first error.
+type specParser struct {
+	fields []string
+	err    error
+}
+
+func (p *specParser) float(i int) float64 {
+	v, err := strconv.ParseFloat(p.fields[i], 64)
+	p.keep(err)
+	return v
+}
+
+func (p *specParser) int(i int) int64 {
+	v, err := strconv.ParseInt(p.fields[i], 10, 64)
+	p.keep(err)
+	return v
+}
+
+func (p *specParser) duration(i int) time.Duration {
+	v, err := time.ParseDuration(p.fields[i])
+	p.keep(err)
+	return v
+}
+
+func (p *specParser) keep(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
@@ -0,0 +1,126 @@
+package instanatest
+
+import (
+	"math"
+	"time"
+)
+
+// Generator returns the value of a synthetic series at ts in epoch ms. It returns false when the series
+// has no point at ts.
+type Generator func(ts int64) (float64, bool)
+
+// Points samples g every rollup seconds between from and to (in ms) inclusive. Timestamps are aligned to
+// the rollup as they are in API responses.
+func Points(g Generator, from int64, to int64, rollup int64) [][]float64 {
+	step := rollup * 1000
+	if step <= 0 {
+		return nil
+	}
+
+	start := from - from%step
+	if start < from {
+		start += step
+	}
+
+	var points [][]float64
+	for ts := start; ts <= to; ts += step {
+		v, ok := g(ts)
+		if !ok {
+			continue
+		}
+		points = append(points, []float64{float64(ts), v})
+	}
+	return points
+}
+
+// Constant returns v at every timestamp.
+func Constant(v float64) Generator {
+	return func(ts int64) (float64, bool) {
+		return v, true
+	}
+}
+
+// Sine oscillates around mean by amplitude with the specified period, starting at mean at the epoch. A
+// period shorter than 1ms is constant.
+func Sine(mean float64, amplitude float64, period time.Duration) Generator {
+	if toMillis(period) < 1 {
+		return Constant(mean)
+	}
+	return func(ts int64) (float64, bool) {
+		phase := float64(ts%toMillis(period)) / float64(toMillis(period))
+		return mean + amplitude*math.Sin(2*math.Pi*phase), true
+	}
+}
+
+// Diurnal follows a daily cycle between low at midnight UTC and high at midday UTC.
+func Diurnal(low float64, high float64) Generator {
+	day := toMillis(24 * time.Hour)
+	return func(ts int64) (float64, bool) {
+		phase := float64(ts%day) / float64(day)
+		return low + (high-low)*(1-math.Cos(2*math.Pi*phase))/2, true
+	}
+}
+
+// Step returns before until at (in ms) and after from then on.
+func Step(before float64, after float64, at int64) Generator {
+	return func(ts int64) (float64, bool) {
+		if ts < at {
+			return before, true
+		}
+		return after, true
+	}
+}
+
+// Counter increases by rate per second from 0 and resets to 0 every resetEvery, a resetEvery of 0 never
+// resets.
+func Counter(rate float64, resetEvery time.Duration) Generator {
+	return func(ts int64) (float64, bool) {
+		if toMillis(resetEvery) > 0 {
+			ts %= toMillis(resetEvery)
+		}
+		return rate * float64(ts) / 1000, true
+	}
+}
+
+// Add sums the generators, a point is missing if it is missing from any of them.
+func Add(gs ...Generator) Generator {
+	return func(ts int64) (float64, bool) {
+		var sum float64
+		for _, g := range gs {
+			v, ok := g(ts)
+			if !ok {
+				return 0, false
+			}
+			sum += v
+		}
+		return sum, true
+	}
+}
+
+// Gap removes the points of g between from and to (in ms), from inclusive and to exclusive.
+func Gap(g Generator, from int64, to int64) Generator {
+	return func(ts int64) (float64, bool) {
+		if ts >= from && ts < to {
+			return 0, false
+		}
+		return g(ts)
+	}
+}
+
+// Inject replaces the points of g at the timestamps (in ms) with v, typically math.NaN() or math.Inf(1).
+func Inject(g Generator, v float64, timestamps ...int64) Generator {
+	var at = make(map[int64]bool, len(timestamps))
+	for _, ts := range timestamps {
+		at[ts] = true
+	}
+	return func(ts int64) (float64, bool) {
+		if at[ts] {
+			return v, true
+		}
+		return g(ts)
+	}
+}
+
+func toMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,67 @@
+package instanatest_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib/instanatest"
+)
+
+func Test_Points(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		g        instanatest.Generator
+		from     int64
+		to       int64
+		expected [][]float64
+	}{
+		"constant":          {instanatest.Constant(2), 0, 3000, [][]float64{{0, 2}, {1000, 2}, {2000, 2}, {3000, 2}}},
+		"aligned to rollup": {instanatest.Constant(2), 500, 2500, [][]float64{{1000, 2}, {2000, 2}}},
+		"step":              {instanatest.Step(1, 5, 2000), 0, 3000, [][]float64{{0, 1}, {1000, 1}, {2000, 5}, {3000, 5}}},
+		"counter reset":     {instanatest.Counter(10, 2*time.Second), 0, 3000, [][]float64{{0, 0}, {1000, 10}, {2000, 0}, {3000, 10}}},
+		"gap":               {instanatest.Gap(instanatest.Constant(2), 1000, 3000), 0, 3000, [][]float64{{0, 2}, {3000, 2}}},
+		"add":               {instanatest.Add(instanatest.Constant(2), instanatest.Step(0, 1, 1000)), 0, 1000, [][]float64{{0, 2}, {1000, 3}}},
+		"sine":              {instanatest.Sine(10, 5, 4*time.Second), 0, 3000, [][]float64{{0, 10}, {1000, 15}, {2000, 10}, {3000, 5}}},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			actual := instanatest.Points(tc.g, tc.from, tc.to, 1)
+			if !cmp.Equal(actual, tc.expected, cmp.Comparer(approx)) {
+				t.Errorf("Points() diff: %v", cmp.Diff(actual, tc.expected))
+			}
+		})
+	}
+}
+
+func Test_Diurnal(t *testing.T) {
+	t.Parallel()
+
+	g := instanatest.Diurnal(10, 90)
+	midnight := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	midday := midnight + 12*3600*1000
+
+	if v, _ := g(midnight); !approx(v, 10) {
+		t.Errorf("midnight = %v, want 10", v)
+	}
+	if v, _ := g(midday); !approx(v, 90) {
+		t.Errorf("midday = %v, want 90", v)
+	}
+}
+
+func Test_Inject(t *testing.T) {
+	t.Parallel()
+
+	g := instanatest.Inject(instanatest.Constant(1), math.NaN(), 1000)
+	points := instanatest.Points(g, 0, 2000, 1)
+	if len(points) != 3 || !math.IsNaN(points[1][1]) || points[2][1] != 1 {
+		t.Errorf("Points() = %v, want NaN at 1000", points)
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,333 @@
+package instanatest
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// DefaultRateLimit is the number of calls per hour allowed by an Instana unit.
+const DefaultRateLimit = 5000
+
+const apiPrefix = "/api/infrastructure-monitoring/"
+
+// Fault is a failure injected into a response. A zero Status delays the normal response by Delay.
+type Fault struct {
+	Status int
+	Delay  time.Duration
+}
+
+// Handler serves the infrastructure endpoints used by the library from fixtures. It checks the apiToken
+// authorization header, paces calls with X-Ratelimit-* headers and injects faults. The exported fields
+// must be set before serving requests.
+type Handler struct {
+	Token string
+	// RateLimit is the number of calls allowed per RateWindow.
+	RateLimit  int
+	RateWindow time.Duration
+	// FailRate is the fraction of requests randomly failed with FailStatus.
+	FailRate   float64
+	FailStatus int
+	// Delay is added to every response.
+	Delay time.Duration
+
+	fixtures Fixtures
+	fake     *Fake
+	mux      *http.ServeMux
+
+	mu        sync.Mutex
+	faults    []Fault
+	requests  int
+	remaining int
+	reset     time.Time
+	random    *rand.Rand
+}
+
+// NewHandler returns a handler serving fixtures to requests authorized with token.
+func NewHandler(token string, fixtures Fixtures) *Handler {
+	var snapshots []Snapshot
+	for _, s := range fixtures.Snapshots {
+		var metrics = make(map[string]Generator, len(s.Metrics))
+		for name, series := range s.Metrics {
+			metrics[name] = series.Generator
+		}
+		snapshots = append(snapshots, Snapshot{SnapshotItem: s.SnapshotItem, Data: s.Data, Metrics: metrics})
+	}
+
+	h := &Handler{
+		Token:      token,
+		RateLimit:  DefaultRateLimit,
+		RateWindow: time.Hour,
+		FailStatus: http.StatusInternalServerError,
+		fixtures:   fixtures,
+		fake:       NewFake(snapshots...),
+		mux:        http.NewServeMux(),
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	// The handler never reads the fake's calls, don't keep them in long running servers.
+	h.fake.SetMaxCalls(0)
+
+	h.mux.HandleFunc(apiPrefix+"metrics", h.metrics)
+	h.mux.HandleFunc(apiPrefix+"snapshots", h.snapshots)
+	h.mux.HandleFunc(apiPrefix+"snapshots/", h.snapshot)
+	h.mux.HandleFunc(apiPrefix+"catalog/plugins", h.plugins)
+	h.mux.HandleFunc(apiPrefix+"catalog/metrics/", h.catalogMetrics)
+	h.mux.HandleFunc(apiPrefix+"catalog/search", h.searchFields)
+	h.mux.HandleFunc(apiPrefix+"graph/views", h.viewTree)
+	h.mux.HandleFunc(apiPrefix+"graph/related-hosts/", h.relatedHosts)
+
+	return h
+}
+
+// NewServer starts a test server serving fixtures, the caller must close it.
+func NewServer(token string, fixtures Fixtures) (*httptest.Server, *Handler) {
+	h := NewHandler(token, fixtures)
+	return httptest.NewServer(h), h
+}
+
+// Inject queues faults applied to the following requests in order.
+func (h *Handler) Inject(faults ...Fault) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.faults = append(h.faults, faults...)
+}
+
+// Requests returns the number of authorized requests received.
+func (h *Handler) Requests() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "apiToken "+h.Token {
+		writeError(w, http.StatusUnauthorized, "invalid API token")
+		return
+	}
+
+	fault, limited := h.admit(w.Header())
+	if limited {
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	if delay := fault.Delay + h.Delay; delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if fault.Status != 0 {
+		writeError(w, fault.Status, http.StatusText(fault.Status))
+		return
+	}
+
+	h.mux.ServeHTTP(w, req)
+}
+
+// admit counts the request against the rate limit, sets the rate limit headers and selects a fault.
+func (h *Handler) admit(header http.Header) (Fault, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.requests++
+	now := time.Now()
+	if !now.Before(h.reset) {
+		h.remaining = h.RateLimit
+		h.reset = now.Add(h.RateWindow)
+	}
+
+	header.Set("X-Ratelimit-Limit", strconv.Itoa(h.RateLimit))
+	header.Set("X-Ratelimit-Reset", strconv.FormatInt(h.reset.Unix(), 10))
+	if h.remaining < 1 {
+		header.Set("X-Ratelimit-Remaining", "0")
+		header.Set("Retry-After", strconv.Itoa(int(time.Until(h.reset).Seconds())+1))
+		return Fault{}, true
+	}
+	h.remaining--
+	header.Set("X-Ratelimit-Remaining", strconv.Itoa(h.remaining))
+
+	if len(h.faults) > 0 {
+		fault := h.faults[0]
+		h.faults = h.faults[1:]
+		return fault, false
+	}
+	if h.FailRate > 0 && h.random.Float64() < h.FailRate {
+		return Fault{Status: h.FailStatus}, false
+	}
+	return Fault{}, false
+}
+
+func (h *Handler) metrics(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodPost) {
+		return
+	}
+
+	var q openapi.GetCombinedMetrics
+	err := json.NewDecoder(req.Body).Decode(&q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	windowSize := q.TimeFrame.WindowSize
+	if windowSize == 0 {
+		windowSize = int64(time.Hour / time.Millisecond)
+	}
+	rollup := int64(q.Rollup)
+	if rollup == 0 {
+		rollup = instana.AutoRollup(windowSize)
+	}
+
+	items, err := h.fake.ListMetricsContext(req.Context(), q.Query, q.Plugin, q.Metrics, rollup, windowSize, q.TimeFrame.To)
+	switch {
+	case errors.Is(err, instana.ErrNoMetrics):
+		items = []openapi.MetricItem{}
+	case errors.Is(err, instana.ErrInvalidQuery):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, openapi.InfrastructureMetricResult{Items: items})
+}
+
+func (h *Handler) snapshots(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+
+	params := req.URL.Query()
+	windowSize, _ := strconv.ParseInt(params.Get("windowSize"), 10, 64)
+	items, err := h.fake.ListSnapshotsContext(req.Context(), params.Get("query"), params.Get("plugin"), windowSize)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, openapi.SnapshotResult{Items: items})
+}
+
+func (h *Handler) snapshot(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+
+	id := strings.TrimPrefix(req.URL.Path, apiPrefix+"snapshots/")
+	snapshot, err := h.fake.GetSnapshotContext(req.Context(), id)
+	if errors.Is(err, instana.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, snapshot)
+}
+
+func (h *Handler) plugins(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+	plugins := h.fixtures.Plugins
+	if plugins == nil {
+		plugins = []openapi.PluginResult{}
+	}
+	writeJSON(w, plugins)
+}
+
+func (h *Handler) catalogMetrics(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+
+	plugin := strings.TrimPrefix(req.URL.Path, apiPrefix+"catalog/metrics/")
+	metrics, ok := h.fixtures.CatalogMetrics[plugin]
+	if !ok {
+		writeError(w, http.StatusNotFound, "plugin "+plugin+" not found")
+		return
+	}
+	writeJSON(w, metrics)
+}
+
+func (h *Handler) searchFields(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+	fields := h.fixtures.SearchFields
+	if fields == nil {
+		fields = []openapi.SearchFieldResult{}
+	}
+	writeJSON(w, fields)
+}
+
+func (h *Handler) viewTree(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+	tree, err := h.fake.GetViewTreeContext(req.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, openapi.TreeNodeResult{Tree: tree})
+}
+
+func (h *Handler) relatedHosts(w http.ResponseWriter, req *http.Request) {
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+
+	id := strings.TrimPrefix(req.URL.Path, apiPrefix+"graph/related-hosts/")
+	hosts, err := h.fake.ListRelatedHostsContext(req.Context(), id)
+	if errors.Is(err, instana.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, hosts)
+}
+
+// allow writes a 405 response and returns false if req does not use method.
+func allow(w http.ResponseWriter, req *http.Request, method string) bool {
+	if req.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {message}})
+}
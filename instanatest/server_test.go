@@ -0,0 +1,166 @@
+package instanatest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/instanatest"
+)
+
+const token = "test-token"
+
+func loadFixtures(t *testing.T) instanatest.Fixtures {
+	t.Helper()
+	fixtures, err := instanatest.LoadFixtures("testdata/fixtures.json")
+	if err != nil {
+		t.Fatalf("LoadFixtures() error = %v", err)
+	}
+	return fixtures
+}
+
+func Test_Server_ListMetricsContext(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := instanatest.NewServer(token, loadFixtures(t))
+	defer srv.Close()
+
+	api, err := instana.NewClient(srv.URL, token)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	items, err := api.ListMetricsContext(context.Background(), "entity.zone:Instana-demo", "host", []string{"load.1min"}, 1, 2000, 1601553602000)
+	if err != nil {
+		t.Fatalf("ListMetricsContext() error = %v", err)
+	}
+	if len(items) != 1 || items[0].SnapshotId != "host-a" {
+		t.Fatalf("ListMetricsContext() = %v, want host-a", items)
+	}
+	expected := [][]float64{{1601553600000, 1.5}, {1601553601000, 1.75}, {1601553602000, 2}}
+	if !cmp.Equal(items[0].Metrics["load.1min"], expected) {
+		t.Errorf("load.1min diff: %v", cmp.Diff(items[0].Metrics["load.1min"], expected))
+	}
+
+	snapshots, err := api.ListSnapshotsContext(context.Background(), "", "dropwizardApplicationContainer", 60000)
+	if err != nil {
+		t.Fatalf("ListSnapshotsContext() error = %v", err)
+	}
+	if len(snapshots) != 3 {
+		t.Errorf("len(snapshots) = %v, want 3", len(snapshots))
+	}
+}
+
+func Test_Server_faults(t *testing.T) {
+	t.Parallel()
+
+	fast := instana.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	td := map[string]struct {
+		token    string
+		faults   []instanatest.Fault
+		expected error
+		requests int
+	}{
+		"invalid token":        {"wrong", nil, instana.ErrAuth, 0},
+		"server error retried": {token, []instanatest.Fault{{Status: 500}}, nil, 2},
+		"server errors":        {token, []instanatest.Fault{{Status: 500}, {Status: 503}}, instana.ErrServer, 2},
+		"rate limited":         {token, []instanatest.Fault{{Status: 429}, {Status: 429}}, instana.ErrRateLimited, 2},
+		"slow response":        {token, []instanatest.Fault{{Delay: 10 * time.Millisecond}}, nil, 1},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, h := instanatest.NewServer(token, loadFixtures(t))
+			defer srv.Close()
+			h.Inject(tc.faults...)
+
+			api, err := instana.NewClient(srv.URL, tc.token, instana.WithRetryPolicy(fast))
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			_, err = api.ListMetricsContext(context.Background(), "", "host", []string{"cpu.user"}, 1, 60000, 1601553600000)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("ListMetricsContext() error = %v, want %v", err, tc.expected)
+			}
+			if h.Requests() != tc.requests {
+				t.Errorf("Requests() = %v, want %v", h.Requests(), tc.requests)
+			}
+		})
+	}
+}
+
+func Test_Server_rate_limit(t *testing.T) {
+	t.Parallel()
+
+	srv, h := instanatest.NewServer(token, loadFixtures(t))
+	defer srv.Close()
+	h.RateLimit = 1
+
+	var statuses []int
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/infrastructure-monitoring/catalog/plugins", nil)
+		req.Header.Set("Authorization", "apiToken "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+		if resp.Header.Get("X-Ratelimit-Remaining") != "0" {
+			t.Errorf("X-Ratelimit-Remaining = %q, want 0", resp.Header.Get("X-Ratelimit-Remaining"))
+		}
+	}
+
+	expected := []int{http.StatusOK, http.StatusTooManyRequests}
+	if !cmp.Equal(statuses, expected) {
+		t.Errorf("statuses = %v, want %v", statuses, expected)
+	}
+}
+
+func Test_Server_endpoints(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := instanatest.NewServer(token, loadFixtures(t))
+	defer srv.Close()
+
+	td := map[string]struct {
+		method string
+		path   string
+		status int
+	}{
+		"catalog plugins":       {http.MethodGet, "/api/infrastructure-monitoring/catalog/plugins", http.StatusOK},
+		"catalog metrics":       {http.MethodGet, "/api/infrastructure-monitoring/catalog/metrics/host", http.StatusOK},
+		"unknown plugin":        {http.MethodGet, "/api/infrastructure-monitoring/catalog/metrics/jvm", http.StatusNotFound},
+		"search fields":         {http.MethodGet, "/api/infrastructure-monitoring/catalog/search", http.StatusOK},
+		"snapshot":              {http.MethodGet, "/api/infrastructure-monitoring/snapshots/host-a", http.StatusOK},
+		"unknown snapshot":      {http.MethodGet, "/api/infrastructure-monitoring/snapshots/nope", http.StatusNotFound},
+		"metrics requires POST": {http.MethodGet, "/api/infrastructure-monitoring/metrics", http.StatusMethodNotAllowed},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+			req.Header.Set("Authorization", "apiToken "+token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("status = %v, want %v", resp.StatusCode, tc.status)
+			}
+			if resp.Header.Get("X-Ratelimit-Remaining") == "" {
+				t.Error("X-Ratelimit-Remaining header missing")
+			}
+		})
+	}
+}
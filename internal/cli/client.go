@@ -0,0 +1,279 @@
+// Package cli holds the command line plumbing shared by the infraq and webui commands.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nfisher/instana-crib"
+)
+
+// ClientFlags holds the settings used to build an Instana API client. Settings come from a named profile
+// in the configuration file when one is selected, otherwise the URL and token are read from the
+// environment. Connection flags explicitly set on the command line take precedence over the profile.
+type ClientFlags struct {
+	URL   string
+	Token string
+	TLS   instana.TLSOptions
+	Proxy string
+	// Query is the default query of the selected profile.
+	Query string
+
+	ProfileName string
+	ConfigPath  string
+
+	// Record saves API responses as fixtures in the directory, Replay serves them without network access.
+	Record string
+	Replay string
+
+	profiles []instana.Profile
+}
+
+// Register reads INSTANA_URL and INSTANA_TOKEN and registers the profile, TLS, proxy and fixture flags with fs.
+func (c *ClientFlags) Register(fs *flag.FlagSet) {
+	c.URL = os.Getenv("INSTANA_URL")
+	c.Token = os.Getenv("INSTANA_TOKEN")
+
+	insecure, _ := strconv.ParseBool(os.Getenv("INSTANA_INSECURE"))
+	configPath, _ := instana.DefaultConfigPath()
+	if v := os.Getenv("INSTANA_CONFIG"); v != "" {
+		configPath = v
+	}
+
+	fs.StringVar(&c.ProfileName, "profile", os.Getenv("INSTANA_PROFILE"), "named tenant profile from the config file (env INSTANA_PROFILE)")
+	fs.StringVar(&c.ConfigPath, "config", configPath, "config file containing tenant profiles (env INSTANA_CONFIG)")
+	fs.StringVar(&c.TLS.CAFile, "ca-cert", os.Getenv("INSTANA_CA_CERT"), "PEM bundle of additional certificate authorities to trust (env INSTANA_CA_CERT)")
+	fs.StringVar(&c.TLS.CertFile, "cert", os.Getenv("INSTANA_CLIENT_CERT"), "PEM client certificate for mutual TLS (env INSTANA_CLIENT_CERT)")
+	fs.StringVar(&c.TLS.KeyFile, "key", os.Getenv("INSTANA_CLIENT_KEY"), "PEM client key for mutual TLS (env INSTANA_CLIENT_KEY)")
+	fs.StringVar(&c.Proxy, "proxy", os.Getenv("INSTANA_PROXY"), "proxy URL for API requests, defaults to HTTPS_PROXY (env INSTANA_PROXY)")
+	fs.BoolVar(&c.TLS.InsecureSkipVerify, "insecure", insecure, "skip TLS certificate verification, the token is still sent (env INSTANA_INSECURE)")
+	fs.StringVar(&c.Record, "record", "", "record API responses as fixtures in this directory")
+	fs.StringVar(&c.Replay, "replay", "", "replay API responses from fixtures in this directory instead of calling the API")
+}
+
+// Resolve applies the selected profiles after fs has been parsed. Several profiles may be selected as a
+// comma separated list to query them all. The config file's default profile is used when no profile is
+// selected and INSTANA_URL is unset.
+func (c *ClientFlags) Resolve(fs *flag.FlagSet) error {
+	if c.ProfileName == "" && c.URL != "" {
+		return nil
+	}
+
+	cfg, err := instana.LoadConfig(c.ConfigPath)
+	if os.IsNotExist(err) && c.ProfileName == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.ProfileName == "" && cfg.Default == "" {
+		return nil
+	}
+
+	var names = []string{cfg.Default}
+	if c.ProfileName != "" {
+		names = strings.Split(c.ProfileName, ",")
+	}
+
+	var profiles []instana.Profile
+	for _, name := range names {
+		profile, err := cfg.Profile(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		profile.Token, err = profile.ResolveToken()
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, c.override(fs, profile))
+	}
+
+	first := profiles[0]
+	c.profiles = profiles
+	c.ProfileName = strings.Join(profileNames(profiles), ",")
+	c.URL = first.URL
+	c.Token = first.Token
+	c.Query = first.Query
+	c.TLS = first.TLS
+	c.Proxy = first.Proxy
+
+	return nil
+}
+
+// override replaces the profile's connection settings with those explicitly set on the command line.
+func (c *ClientFlags) override(fs *flag.FlagSet, profile instana.Profile) instana.Profile {
+	if IsSet(fs, "ca-cert") {
+		profile.TLS.CAFile = c.TLS.CAFile
+	}
+	if IsSet(fs, "cert") {
+		profile.TLS.CertFile = c.TLS.CertFile
+	}
+	if IsSet(fs, "key") {
+		profile.TLS.KeyFile = c.TLS.KeyFile
+	}
+	if IsSet(fs, "insecure") {
+		profile.TLS.InsecureSkipVerify = c.TLS.InsecureSkipVerify
+	}
+	if IsSet(fs, "proxy") {
+		profile.Proxy = c.Proxy
+	}
+	return profile
+}
+
+func profileNames(profiles []instana.Profile) []string {
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// IsSet reports whether the flag name was explicitly set on the command line.
+func IsSet(fs *flag.FlagSet, name string) bool {
+	var set bool
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Validate returns an error if the API URL or token are missing. Neither is required when replaying fixtures.
+func (c *ClientFlags) Validate() error {
+	if c.Record != "" && c.Replay != "" {
+		return errors.New("-record and -replay cannot be used together")
+	}
+
+	if c.Replay != "" {
+		if c.URL == "" {
+			c.URL = replayURL
+		}
+		return nil
+	}
+
+	if c.Token == "" {
+		return errors.New("INSTANA_TOKEN environment variable should be set to the Instana API token. Was a k8s secret created for this?")
+	}
+
+	if c.URL == "" {
+		return errors.New("INSTANA_URL environment variable should be set to the Instana API end-point. Was a k8s secret created for this?")
+	}
+
+	return nil
+}
+
+// NewClient builds a client from the flags with opts applied after the connection settings.
+func (c *ClientFlags) NewClient(opts ...instana.ClientOption) (*instana.InfraQueryAPI, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []instana.ClientOption{
+		instana.WithTLS(c.TLS),
+	}
+	if c.Proxy != "" {
+		options = append(options, instana.WithProxy(c.Proxy))
+	}
+	options = append(options, c.fixtureOptions("")...)
+	options = append(options, opts...)
+
+	return instana.NewClient(c.URL, c.Token, options...)
+}
+
+// replayURL is used when replaying fixtures without an API URL, fixtures are matched regardless of host.
+const replayURL = "https://replay.invalid"
+
+// fixtureOptions returns the record or replay option for the tenant, each tenant uses a sub-directory when
+// several profiles are selected so identical requests to different tenants don't collide.
+func (c *ClientFlags) fixtureOptions(tenant string) []instana.ClientOption {
+	var options []instana.ClientOption
+	if c.Record != "" {
+		options = append(options, instana.WithRecording(filepath.Join(c.Record, tenant)))
+	}
+	if c.Replay != "" {
+		options = append(options, instana.WithReplay(filepath.Join(c.Replay, tenant)))
+	}
+	return options
+}
+
+// NewTenants builds a client for each selected profile, or a single tenant from the environment when no
+// profile is selected.
+func (c *ClientFlags) NewTenants(opts ...instana.ClientOption) ([]instana.Tenant, error) {
+	if len(c.profiles) == 0 {
+		api, err := c.NewClient(opts...)
+		if err != nil {
+			return nil, err
+		}
+		return []instana.Tenant{{Name: c.URL, Client: api}}, nil
+	}
+
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []instana.Tenant
+	for _, p := range c.profiles {
+		api, err := c.newProfileClient(p, opts...)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, instana.Tenant{Name: p.Name, Client: api})
+	}
+	return tenants, nil
+}
+
+func (c *ClientFlags) newProfileClient(p instana.Profile, opts ...instana.ClientOption) (*instana.InfraQueryAPI, error) {
+	var tenant string
+	if len(c.profiles) > 1 {
+		tenant = p.Name
+	}
+	api, err := instana.NewClientFromProfile(p, append(c.fixtureOptions(tenant), opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	return api, nil
+}
+
+// NewCatalog builds a cached catalog for the first selected profile, or from the environment when no
+// profile is selected.
+func (c *ClientFlags) NewCatalog(opts ...instana.ClientOption) (instana.InfraCatalog, error) {
+	if len(c.profiles) == 0 {
+		api, err := c.NewClient(opts...)
+		if err != nil {
+			return nil, err
+		}
+		return instana.NewCatalogCache(api), nil
+	}
+
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	api, err := c.newProfileClient(c.profiles[0], opts...)
+	if err != nil {
+		return nil, err
+	}
+	return instana.NewCatalogCache(api), nil
+}
+
+// NewQuery builds a query client for the selected profiles, fanning out to every tenant when more than one
+// profile is selected.
+func (c *ClientFlags) NewQuery(opts ...instana.ClientOption) (instana.InfraQueryContext, error) {
+	tenants, err := c.NewTenants(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenants) == 1 {
+		return tenants[0].Client, nil
+	}
+	return instana.NewMultiTenantClient(tenants...), nil
+}
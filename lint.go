@@ -0,0 +1,138 @@
+package instana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// Severities of LintIssue.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// LintIssue is a problem found in a Dynamic Focus query.
+type LintIssue struct {
+	// Pos is the byte offset of the problem in the query.
+	Pos      int    `json:"pos"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("column %d: %s: %s", i.Pos+1, i.Severity, i.Message)
+}
+
+// LintQuery checks query for syntax errors, keywords missing from the catalog's search fields, values
+// outside a field's fixed values and wildcards that match every value. The error is only set if the
+// catalog could not be retrieved.
+func LintQuery(ctx context.Context, catalog InfraCatalog, query string) ([]LintIssue, error) {
+	q, err := ParseQuery(query)
+	var syntax *SyntaxError
+	if errors.As(err, &syntax) {
+		return []LintIssue{{Pos: syntax.Pos, Severity: SeverityError, Message: syntax.Msg}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := catalog.ListSearchFieldsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var keywords []string
+	var known = make(map[string]openapi.SearchFieldResult, len(fields))
+	for _, f := range fields {
+		keywords = append(keywords, f.Keyword)
+		known[f.Keyword] = f
+	}
+
+	var issues []LintIssue
+	Walk(q, func(n Query) {
+		t, ok := n.(Term)
+		if !ok {
+			return
+		}
+
+		if t.Wildcard && isUnbounded(t.Value) {
+			issues = append(issues, LintIssue{
+				Pos:      t.Pos,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("%s starts with a wildcard and may match every snapshot", t),
+			})
+		}
+
+		if t.Keyword == "" {
+			return
+		}
+		field, ok := known[t.Keyword]
+		if !ok {
+			msg := unknownName("keyword", t.Keyword, keywords).Error()
+			issues = append(issues, LintIssue{
+				Pos:      t.Pos,
+				Severity: SeverityError,
+				Message:  strings.TrimPrefix(msg, ErrInvalidQuery.Error()+": "),
+			})
+			return
+		}
+		if len(field.FixedValues) > 0 && !matchesAny(t, field.FixedValues) {
+			issues = append(issues, LintIssue{
+				Pos:      t.Pos,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("%s matches none of the values of %s: %s", t, t.Keyword, strings.Join(field.FixedValues, ", ")),
+			})
+		}
+	})
+
+	return issues, nil
+}
+
+// isUnbounded reports whether a wildcard pattern starts with a wildcard.
+func isUnbounded(pattern string) bool {
+	return strings.HasPrefix(pattern, "*") || strings.HasPrefix(pattern, "?")
+}
+
+// matchesAny reports whether the term's value or pattern matches one of values.
+func matchesAny(t Term, values []string) bool {
+	for _, v := range values {
+		if t.Wildcard {
+			if wildcardMatch(t.Value, v) {
+				return true
+			}
+		} else if t.Value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch reports whether s matches pattern where * matches any characters and ? any single character.
+func wildcardMatch(pattern string, s string) bool {
+	p, r := []rune(pattern), []rune(s)
+	var pi, ri int
+	var star, mark = -1, 0
+	for ri < len(r) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == r[ri]):
+			pi++
+			ri++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ri
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ri = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,42 @@
+package instana_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_LintQuery(t *testing.T) {
+	t.Parallel()
+
+	catalog := searchFields{
+		{Keyword: "entity.zone"},
+		{Keyword: "entity.type", FixedValues: []string{"host", "docker"}},
+	}
+
+	td := map[string]struct {
+		query    string
+		expected []instana.LintIssue
+	}{
+		"clean":              {`entity.type:host AND entity.zone:us-east-*`, nil},
+		"syntax error":       {`entity.zone:(`, []instana.LintIssue{{Pos: 12, Severity: instana.SeverityError, Message: `expected a value after entity.zone:, found "("`}}},
+		"unknown keyword":    {`entity.type:host AND entity.zoen:x`, []instana.LintIssue{{Pos: 21, Severity: instana.SeverityError, Message: `unknown keyword "entity.zoen", did you mean "entity.zone"?`}}},
+		"fixed value":        {`entity.type:hots`, []instana.LintIssue{{Pos: 0, Severity: instana.SeverityError, Message: `entity.type:hots matches none of the values of entity.type: host, docker`}}},
+		"fixed wildcard":     {`entity.type:dock*`, nil},
+		"unbounded wildcard": {`entity.zone:*east*`, []instana.LintIssue{{Pos: 0, Severity: instana.SeverityWarning, Message: `entity.zone:*east* starts with a wildcard and may match every snapshot`}}},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			issues, err := instana.LintQuery(context.Background(), catalog, tc.query)
+			if err != nil {
+				t.Fatalf("LintQuery() error = %v", err)
+			}
+			if !cmp.Equal(issues, tc.expected) {
+				t.Errorf("LintQuery(%s) diff: %v", tc.query, cmp.Diff(issues, tc.expected))
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package instana
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError describes a malformed Dynamic Focus query.
+type SyntaxError struct {
+	// Pos is the byte offset of the error in the query.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at column %d: %s", e.Pos+1, e.Msg)
+}
+
+// ParseQuery parses a Dynamic Focus query into the nodes used by the query builder. Terms juxtaposed
+// without an operator are combined with AND, AND binds tighter than OR and NOT applies to the following
+// term or group. Errors are returned as a *SyntaxError holding the position. An empty query parses to an
+// empty BoolQuery.
+func ParseQuery(query string) (Query, error) {
+	p := parser{lexer: lexer{input: query}}
+	p.next()
+
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	if q == nil {
+		return And(), nil
+	}
+	return q, nil
+}
+
+type parser struct {
+	lexer lexer
+	tok   token
+	err   error
+}
+
+func (p *parser) next() {
+	var err error
+	p.tok, err = p.lexer.next()
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return &SyntaxError{Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseOr parses and ( OR and )*, returning nil for an empty query.
+func (p *parser) parseOr() (Query, error) {
+	first, err := p.parseAnd()
+	if err != nil || first == nil {
+		return first, err
+	}
+
+	clauses := []Query{first}
+	for p.tok.isOperator(OpOr) {
+		p.next()
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if q == nil {
+			return nil, p.errorf("expected a term after OR, found %s", p.tok)
+		}
+		clauses = append(clauses, q)
+	}
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	return Or(clauses...), nil
+}
+
+// parseAnd parses unary ( [AND] unary )*, returning nil if there is no term.
+func (p *parser) parseAnd() (Query, error) {
+	var clauses []Query
+	for {
+		explicit := p.tok.isOperator(OpAnd)
+		if explicit {
+			if len(clauses) == 0 {
+				return nil, p.errorf("expected a term before AND")
+			}
+			p.next()
+		}
+		if !p.tok.startsTerm() {
+			if explicit {
+				return nil, p.errorf("expected a term after AND, found %s", p.tok)
+			}
+			break
+		}
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, q)
+	}
+
+	switch len(clauses) {
+	case 0:
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, nil
+	case 1:
+		return clauses[0], nil
+	}
+	return And(clauses...), nil
+}
+
+// parseUnary parses NOT unary | ( or ) | term.
+func (p *parser) parseUnary() (Query, error) {
+	switch {
+	case p.tok.isOperator("NOT"):
+		p.next()
+		if !p.tok.startsTerm() {
+			return nil, p.errorf("expected a term after NOT, found %s", p.tok)
+		}
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(q), nil
+
+	case p.tok.kind == tokLParen:
+		open := p.tok.pos
+		p.next()
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if q == nil {
+			return nil, p.errorf("expected a term after (, found %s", p.tok)
+		}
+		if p.tok.kind != tokRParen {
+			if p.tok.kind == tokEOF {
+				return nil, &SyntaxError{Pos: open, Msg: "unclosed ("}
+			}
+			return nil, p.errorf("expected ), found %s", p.tok)
+		}
+		p.next()
+		return Group(q), nil
+	}
+
+	return p.parseTerm()
+}
+
+// parseTerm parses [keyword :] value.
+func (p *parser) parseTerm() (Query, error) {
+	start := p.tok
+	if start.kind != tokWord && start.kind != tokQuoted {
+		return nil, p.errorf("expected a term, found %s", start)
+	}
+	p.next()
+
+	if p.tok.kind != tokColon {
+		return Term{Value: start.value, Wildcard: start.wildcard, Pos: start.pos}, nil
+	}
+	if start.kind != tokWord || start.wildcard {
+		return nil, &SyntaxError{Pos: start.pos, Msg: fmt.Sprintf("invalid keyword %s", start)}
+	}
+	p.next()
+
+	value := p.tok
+	if (value.kind != tokWord && value.kind != tokQuoted) || isOperator(value.raw) {
+		return nil, p.errorf("expected a value after %s:, found %s", start.value, value)
+	}
+	p.next()
+	return Term{Keyword: start.value, Value: value.value, Wildcard: value.wildcard, Pos: start.pos}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokQuoted
+	tokColon
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind  tokenKind
+	pos   int
+	raw   string
+	value string
+	// wildcard is set if the word contains an unescaped * or ?.
+	wildcard bool
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.raw)
+}
+
+func (t token) isOperator(op string) bool {
+	return t.kind == tokWord && t.raw == op
+}
+
+func (t token) startsTerm() bool {
+	switch t.kind {
+	case tokWord:
+		return !t.isOperator(OpAnd) && !t.isOperator(OpOr)
+	case tokQuoted, tokLParen:
+		return true
+	}
+	return false
+}
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) && isSpace(l.input[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	switch l.input[l.pos] {
+	case ':':
+		l.pos++
+		return token{kind: tokColon, pos: start, raw: ":"}, nil
+	case '(':
+		l.pos++
+		return token{kind: tokLParen, pos: start, raw: "("}, nil
+	case ')':
+		l.pos++
+		return token{kind: tokRParen, pos: start, raw: ")"}, nil
+	case '"':
+		return l.quoted()
+	}
+	return l.word()
+}
+
+// quoted reads a double quoted value with backslash escapes.
+func (l *lexer) quoted() (token, error) {
+	start := l.pos
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.input); l.pos++ {
+		c := l.input[l.pos]
+		switch c {
+		case '\\':
+			l.pos++
+			if l.pos >= len(l.input) {
+				return token{kind: tokEOF, pos: l.pos}, &SyntaxError{Pos: l.pos - 1, Msg: "escape at end of query"}
+			}
+			b.WriteByte(l.input[l.pos])
+		case '"':
+			l.pos++
+			return token{kind: tokQuoted, pos: start, raw: l.input[start:l.pos], value: b.String()}, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return token{kind: tokEOF, pos: l.pos}, &SyntaxError{Pos: start, Msg: "unterminated quoted value"}
+}
+
+// word reads a bare value up to whitespace or a delimiter, backslash escapes any character. A Term can't
+// hold a literal * or ? in a wildcard pattern so words mixing escaped and unescaped wildcards are rejected.
+func (l *lexer) word() (token, error) {
+	start := l.pos
+	var b strings.Builder
+	var wildcard, escapedWildcard bool
+	for ; l.pos < len(l.input); l.pos++ {
+		c := l.input[l.pos]
+		if isSpace(c) || c == ':' || c == '(' || c == ')' || c == '"' {
+			break
+		}
+		if c == '\\' {
+			l.pos++
+			if l.pos >= len(l.input) {
+				return token{kind: tokEOF, pos: l.pos}, &SyntaxError{Pos: l.pos - 1, Msg: "escape at end of query"}
+			}
+			escapedWildcard = escapedWildcard || l.input[l.pos] == '*' || l.input[l.pos] == '?'
+			b.WriteByte(l.input[l.pos])
+			continue
+		}
+		if c == '*' || c == '?' {
+			wildcard = true
+		}
+		b.WriteByte(c)
+	}
+	if wildcard && escapedWildcard {
+		return token{kind: tokEOF, pos: l.pos}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("%q mixes escaped and unescaped wildcards", l.input[start:l.pos])}
+	}
+	return token{kind: tokWord, pos: start, raw: l.input[start:l.pos], value: b.String(), wildcard: wildcard}, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,102 @@
+package instana_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_ParseQuery(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		query    string
+		expected instana.Query
+		rendered string
+	}{
+		"term":           {`entity.zone:k8s-demo`, instana.Term{Keyword: "entity.zone", Value: "k8s-demo"}, `entity.zone:k8s-demo`},
+		"wildcard":       {`entity.zone:Instana-*`, instana.Term{Keyword: "entity.zone", Value: "Instana-*", Wildcard: true}, `entity.zone:Instana-*`},
+		"quoted":         {`entity.label:"my \"svc\""`, instana.Term{Keyword: "entity.label", Value: `my "svc"`}, `entity.label:"my \"svc\""`},
+		"escaped":        {`entity.label:my\ svc`, instana.Term{Keyword: "entity.label", Value: "my svc"}, `entity.label:"my svc"`},
+		"escaped star":   {`entity.label:a\*b`, instana.Term{Keyword: "entity.label", Value: "a*b"}, `entity.label:"a*b"`},
+		"free text":      {`checkout`, instana.Term{Value: "checkout"}, `checkout`},
+		"empty":          {`  `, instana.And(), ``},
+		"and":            {`a:1 AND b:2`, instana.And(instana.Term{Keyword: "a", Value: "1"}, instana.Term{Keyword: "b", Value: "2", Pos: 8}), `a:1 AND b:2`},
+		"implicit and":   {`a:1 b:2`, instana.And(instana.Term{Keyword: "a", Value: "1"}, instana.Term{Keyword: "b", Value: "2", Pos: 4}), `a:1 AND b:2`},
+		"precedence":     {`a:1 OR b:2 AND c:3`, nil, `a:1 OR (b:2 AND c:3)`},
+		"group":          {`(a:1 OR b:2) AND c:3`, nil, `(a:1 OR b:2) AND c:3`},
+		"not":            {`NOT a:1 AND NOT (b:2 OR c:3)`, nil, `NOT a:1 AND NOT (b:2 OR c:3)`},
+		"quoted keyword": {`a:"AND"`, instana.Term{Keyword: "a", Value: "AND"}, `a:"AND"`},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			actual, err := instana.ParseQuery(tc.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%s) error = %v", tc.query, err)
+			}
+			if tc.expected != nil && !cmp.Equal(actual, tc.expected) {
+				t.Errorf("ParseQuery(%s) diff: %v", tc.query, cmp.Diff(actual, tc.expected))
+			}
+			if actual.String() != tc.rendered {
+				t.Errorf("ParseQuery(%s).String() = %s, want %s", tc.query, actual.String(), tc.rendered)
+			}
+		})
+	}
+}
+
+func Test_ParseQuery_round_trip(t *testing.T) {
+	t.Parallel()
+
+	for _, query := range []string{`entity.zone:Instana-*`, `entity.label:a\*b`, `entity.label:"a*b?"`, `entity.label:a\?b OR c:d*`} {
+		parsed, err := instana.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%s) error = %v", query, err)
+		}
+		reparsed, err := instana.ParseQuery(parsed.String())
+		if err != nil {
+			t.Fatalf("ParseQuery(%s) error = %v", parsed, err)
+		}
+		if !cmp.Equal(reparsed, parsed, cmpopts.IgnoreFields(instana.Term{}, "Pos")) {
+			t.Errorf("ParseQuery(%s) round trip diff: %v", query, cmp.Diff(reparsed, parsed, cmpopts.IgnoreFields(instana.Term{}, "Pos")))
+		}
+	}
+}
+
+func Test_ParseQuery_errors(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		query string
+		pos   int
+	}{
+		"leading and":        {`AND a:1`, 0},
+		"trailing and":       {`a:1 AND`, 7},
+		"trailing or":        {`a:1 OR `, 7},
+		"missing value":      {`a: AND b:1`, 3},
+		"unclosed group":     {`a:1 AND (b:2`, 8},
+		"extra paren":        {`a:1)`, 3},
+		"empty group":        {`()`, 1},
+		"unterminated quote": {`a:"b`, 2},
+		"dangling escape":    {`a:b\`, 3},
+		"double colon":       {`a:b:c`, 3},
+		"not without term":   {`NOT`, 3},
+		"mixed wildcards":    {`a:x a:b\*c*`, 6},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			_, err := instana.ParseQuery(tc.query)
+			var syntax *instana.SyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("ParseQuery(%s) error = %v, want *SyntaxError", tc.query, err)
+			}
+			if syntax.Pos != tc.pos {
+				t.Errorf("ParseQuery(%s) error = %v, want position %v", tc.query, err, tc.pos)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package instana
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the contents of the configuration file holding the named tenant profiles.
+//
+//	default: staging
+//	profiles:
+//	  staging:
+//	    url: https://staging-acme.instana.io
+//	    tokenFile: staging.token
+//	    query: entity.zone:staging-*
+//	  onprem:
+//	    url: https://instana.acme.internal
+//	    tokenCommand: ["pass", "show", "instana/onprem"]
+//	    tls:
+//	      caFile: acme-ca.pem
+type Config struct {
+	// Default is the profile used when none is selected.
+	Default string `yaml:"default,omitempty"`
+	// Profiles maps a profile name to its settings.
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile describes how to connect to an Instana unit. Exactly one of Token, TokenFile or TokenCommand
+// should be supplied.
+type Profile struct {
+	// Name is the key of the profile in the configuration file.
+	Name string `yaml:"-"`
+	// URL is the base URL of the tenant unit.
+	URL string `yaml:"url"`
+	// Token is the API token.
+	Token string `yaml:"token,omitempty"`
+	// TokenFile is a file containing the API token.
+	TokenFile string `yaml:"tokenFile,omitempty"`
+	// TokenCommand is a command and its arguments which prints the API token, e.g. a password manager.
+	TokenCommand []string `yaml:"tokenCommand,omitempty"`
+	// TLS configures certificate verification and client certificates.
+	TLS TLSOptions `yaml:"tls,omitempty"`
+	// Proxy is the proxy URL used for requests to the unit.
+	Proxy string `yaml:"proxy,omitempty"`
+	// Query is the default Dynamic Focus query, typically restricting to a zone.
+	Query string `yaml:"query,omitempty"`
+}
+
+// DefaultConfigPath returns the location of the configuration file, normally ~/.config/instana-crib/config.yaml.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "instana-crib", "config.yaml"), nil
+}
+
+// LoadConfig reads the configuration file at path. Relative file names in profiles are resolved against
+// the directory containing the configuration file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	err = yaml.UnmarshalStrict(b, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for name, p := range cfg.Profiles {
+		p.Name = name
+		p.TokenFile = resolvePath(dir, p.TokenFile)
+		p.TLS.CAFile = resolvePath(dir, p.TLS.CAFile)
+		p.TLS.CertFile = resolvePath(dir, p.TLS.CertFile)
+		p.TLS.KeyFile = resolvePath(dir, p.TLS.KeyFile)
+		cfg.Profiles[name] = p
+	}
+
+	return &cfg, nil
+}
+
+func resolvePath(dir string, name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// Profile returns the named profile, or the default profile if name is empty.
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.Default
+	}
+	if name == "" {
+		return Profile{}, errors.New("no profile selected and no default profile configured")
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q, available profiles: %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	if p.URL == "" {
+		return Profile{}, fmt.Errorf("profile %q has no url", name)
+	}
+	return p, nil
+}
+
+// ProfileNames returns the names of the configured profiles in sorted order.
+func (c *Config) ProfileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveToken returns the API token from the token, token file or token command.
+func (p Profile) ResolveToken() (string, error) {
+	switch {
+	case p.Token != "":
+		return p.Token, nil
+
+	case p.TokenFile != "":
+		b, err := ioutil.ReadFile(p.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read token for profile %q: %w", p.Name, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+
+	case len(p.TokenCommand) > 0:
+		var stderr bytes.Buffer
+		cmd := exec.Command(p.TokenCommand[0], p.TokenCommand[1:]...)
+		cmd.Stderr = &stderr
+		b, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("token command for profile %q failed: %v: %s", p.Name, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	return "", fmt.Errorf("profile %q has no token, tokenFile or tokenCommand", p.Name)
+}
+
+// ClientOptions returns the client options for the profile's TLS and proxy settings.
+func (p Profile) ClientOptions() []ClientOption {
+	options := []ClientOption{
+		WithTLS(p.TLS),
+	}
+	if p.Proxy != "" {
+		options = append(options, WithProxy(p.Proxy))
+	}
+	return options
+}
+
+// NewClientFromProfile builds a client for the profile with opts applied after the profile's settings.
+func NewClientFromProfile(p Profile, opts ...ClientOption) (*InfraQueryAPI, error) {
+	token, err := p.ResolveToken()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(p.URL, token, append(p.ClientOptions(), opts...)...)
+}
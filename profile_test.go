@@ -0,0 +1,133 @@
+package instana_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+)
+
+const profileConfig = `default: staging
+profiles:
+  staging:
+    url: https://staging-acme.instana.io
+    token: staging-token
+    query: entity.zone:staging-*
+  production:
+    url: https://acme.instana.io
+    tokenFile: production.token
+  onprem:
+    url: https://instana.acme.internal
+    tokenCommand: ["echo", "onprem-token"]
+    proxy: http://proxy.acme.internal:3128
+    tls:
+      caFile: /etc/ssl/acme-ca.pem
+      certFile: client.pem
+      keyFile: client-key.pem
+  missing:
+    url: https://missing.instana.io
+`
+
+func writeConfig(t *testing.T) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	err := ioutil.WriteFile(path, []byte(profileConfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "production.token"), []byte("production-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_LoadConfig_profiles(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t)
+	dir := filepath.Dir(path)
+	cfg, err := instana.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	td := map[string]struct {
+		name     string
+		expected instana.Profile
+		token    string
+	}{
+		"default profile": {"", instana.Profile{
+			Name:  "staging",
+			URL:   "https://staging-acme.instana.io",
+			Token: "staging-token",
+			Query: "entity.zone:staging-*",
+		}, "staging-token"},
+		"token file relative to config": {"production", instana.Profile{
+			Name:      "production",
+			URL:       "https://acme.instana.io",
+			TokenFile: filepath.Join(dir, "production.token"),
+		}, "production-token"},
+		"token command and tls": {"onprem", instana.Profile{
+			Name:         "onprem",
+			URL:          "https://instana.acme.internal",
+			TokenCommand: []string{"echo", "onprem-token"},
+			Proxy:        "http://proxy.acme.internal:3128",
+			TLS: instana.TLSOptions{
+				CAFile:   "/etc/ssl/acme-ca.pem",
+				CertFile: filepath.Join(dir, "client.pem"),
+				KeyFile:  filepath.Join(dir, "client-key.pem"),
+			},
+		}, "onprem-token"},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			p, err := cfg.Profile(tc.name)
+			if err != nil {
+				t.Fatalf("Profile(%q) error = %v", tc.name, err)
+			}
+			if !cmp.Equal(p, tc.expected) {
+				t.Errorf("Profile(%q) -got/+want:\n%s", tc.name, cmp.Diff(tc.expected, p))
+			}
+
+			token, err := p.ResolveToken()
+			if err != nil {
+				t.Fatalf("ResolveToken() error = %v", err)
+			}
+			if token != tc.token {
+				t.Errorf("ResolveToken() = %q, want %q", token, tc.token)
+			}
+		})
+	}
+}
+
+func Test_LoadConfig_errors(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := instana.LoadConfig(writeConfig(t))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	_, err = cfg.Profile("unknown")
+	if err == nil {
+		t.Error("Profile(unknown) error = nil, want error")
+	}
+
+	p, err := cfg.Profile("missing")
+	if err != nil {
+		t.Fatalf("Profile(missing) error = %v", err)
+	}
+	_, err = p.ResolveToken()
+	if err == nil {
+		t.Error("ResolveToken() error = nil, want error for profile without token")
+	}
+
+	_, err = instana.LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	if err == nil {
+		t.Error("LoadConfig(missing file) error = nil, want error")
+	}
+}
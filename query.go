@@ -0,0 +1,224 @@
+package instana
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Query is a node of a Dynamic Focus query. String renders the query string accepted by the API.
+type Query interface {
+	String() string
+}
+
+// Term matches snapshots whose Keyword field has Value, a term without a keyword matches any field. If
+// Wildcard is set * and ? in Value match any characters or any single character.
+type Term struct {
+	Keyword  string
+	Value    string
+	Wildcard bool
+	// Pos is the byte offset of the term in the query string it was parsed from.
+	Pos int
+}
+
+// BoolQuery combines its clauses with Op, either "AND" or "OR".
+type BoolQuery struct {
+	Op      string
+	Clauses []Query
+}
+
+// NotQuery excludes the snapshots matched by Clause.
+type NotQuery struct {
+	Clause Query
+}
+
+// GroupQuery encloses Clause in parentheses.
+type GroupQuery struct {
+	Clause Query
+}
+
+// Boolean operators of BoolQuery.
+const (
+	OpAnd = "AND"
+	OpOr  = "OR"
+)
+
+// Field matches keyword against value literally, the value is quoted if required.
+func Field(keyword string, value string) Term {
+	return Term{Keyword: keyword, Value: value}
+}
+
+// Wildcard matches keyword against pattern where * matches any characters and ? any single character.
+func Wildcard(keyword string, pattern string) Term {
+	return Term{Keyword: keyword, Value: pattern, Wildcard: true}
+}
+
+// And matches snapshots matching all clauses.
+func And(clauses ...Query) BoolQuery {
+	return BoolQuery{Op: OpAnd, Clauses: clauses}
+}
+
+// Or matches snapshots matching any of the clauses.
+func Or(clauses ...Query) BoolQuery {
+	return BoolQuery{Op: OpOr, Clauses: clauses}
+}
+
+// Not excludes snapshots matching clause.
+func Not(clause Query) NotQuery {
+	return NotQuery{Clause: clause}
+}
+
+// Group encloses clause in parentheses. Nested boolean queries are grouped automatically so this is only
+// needed for readability.
+func Group(clause Query) GroupQuery {
+	return GroupQuery{Clause: clause}
+}
+
+// String renders the term escaping characters with special meaning in Dynamic Focus queries.
+func (t Term) String() string {
+	var value string
+	switch {
+	case t.Wildcard && t.Value != "":
+		value = escapeWildcard(t.Value)
+	case isBare(t.Value):
+		value = t.Value
+	default:
+		value = quote(t.Value)
+	}
+
+	if t.Keyword == "" {
+		return value
+	}
+	return t.Keyword + ":" + value
+}
+
+// String renders the clauses joined by the operator, nested boolean queries are grouped.
+func (b BoolQuery) String() string {
+	var parts []string
+	for _, c := range b.Clauses {
+		s := c.String()
+		if s == "" {
+			continue
+		}
+		if nested, ok := c.(BoolQuery); ok && nested.Op != b.Op && nested.clauses() > 1 {
+			s = "(" + s + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " "+b.Op+" ")
+}
+
+// clauses returns the number of non-empty clauses.
+func (b BoolQuery) clauses() int {
+	var n int
+	for _, c := range b.Clauses {
+		if c.String() != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// String renders NOT before the clause, grouping boolean queries.
+func (n NotQuery) String() string {
+	s := n.Clause.String()
+	if s == "" {
+		return ""
+	}
+	if b, ok := n.Clause.(BoolQuery); ok && b.clauses() > 1 {
+		s = "(" + s + ")"
+	}
+	return "NOT " + s
+}
+
+// String renders the clause in parentheses.
+func (g GroupQuery) String() string {
+	s := g.Clause.String()
+	if s == "" {
+		return ""
+	}
+	return "(" + s + ")"
+}
+
+// Walk calls fn for q and each of its descendants in depth first order.
+func Walk(q Query, fn func(Query)) {
+	fn(q)
+	switch n := q.(type) {
+	case BoolQuery:
+		for _, c := range n.Clauses {
+			Walk(c, fn)
+		}
+	case NotQuery:
+		Walk(n.Clause, fn)
+	case GroupQuery:
+		Walk(n.Clause, fn)
+	}
+}
+
+// ValidateQuery returns an error wrapping ErrInvalidQuery if a term of q uses a keyword that is not in the
+// catalog's search fields.
+func ValidateQuery(ctx context.Context, catalog InfraCatalog, q Query) error {
+	fields, err := catalog.ListSearchFieldsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var keywords []string
+	var known = make(map[string]bool, len(fields))
+	for _, f := range fields {
+		keywords = append(keywords, f.Keyword)
+		known[f.Keyword] = true
+	}
+
+	Walk(q, func(n Query) {
+		if t, ok := n.(Term); ok && err == nil && t.Keyword != "" && !known[t.Keyword] {
+			err = unknownName("keyword", t.Keyword, keywords)
+		}
+	})
+	return err
+}
+
+// isBare reports whether value can be rendered without quotes.
+func isBare(value string) bool {
+	// a leading - would be read as negation.
+	if value == "" || isOperator(value) || value[0] == '-' {
+		return false
+	}
+	for _, r := range value {
+		if !isBareRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBareRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-'
+}
+
+func isOperator(value string) bool {
+	return value == OpAnd || value == OpOr || value == "NOT"
+}
+
+// quote encloses value in double quotes escaping backslashes and quotes.
+func quote(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// escapeWildcard backslash escapes every character of pattern that can't appear in a bare value except
+// the * and ? wildcards.
+func escapeWildcard(pattern string) string {
+	if isOperator(pattern) {
+		return `\` + pattern
+	}
+
+	var b strings.Builder
+	for i, r := range pattern {
+		if (!isBareRune(r) && r != '*' && r != '?') || (i == 0 && r == '-') {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package instana_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+func Test_Query_String(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		query    instana.Query
+		expected string
+	}{
+		"field":               {instana.Field("entity.zone", "k8s-demo"), `entity.zone:k8s-demo`},
+		"space is quoted":     {instana.Field("entity.label", "my service"), `entity.label:"my service"`},
+		"colon is quoted":     {instana.Field("entity.label", "host:8080"), `entity.label:"host:8080"`},
+		"quotes are escaped":  {instana.Field("entity.label", `say "hi" \o/`), `entity.label:"say \"hi\" \\o/"`},
+		"operator is quoted":  {instana.Field("entity.label", "AND"), `entity.label:"AND"`},
+		"leading dash":        {instana.Field("entity.label", "-x"), `entity.label:"-x"`},
+		"empty value":         {instana.Field("entity.label", ""), `entity.label:""`},
+		"wildcard":            {instana.Wildcard("entity.zone", "Instana-*"), `entity.zone:Instana-*`},
+		"wildcard escaping":   {instana.Wildcard("entity.label", "*my app:v?*"), `entity.label:*my\ app\:v?*`},
+		"free text":           {instana.Term{Value: "checkout"}, `checkout`},
+		"and":                 {instana.And(instana.Field("entity.type", "host"), instana.Wildcard("entity.zone", "Instana-*")), `entity.type:host AND entity.zone:Instana-*`},
+		"or inside and":       {instana.And(instana.Field("a", "1"), instana.Or(instana.Field("b", "2"), instana.Field("c", "3"))), `a:1 AND (b:2 OR c:3)`},
+		"same op not grouped": {instana.And(instana.Field("a", "1"), instana.And(instana.Field("b", "2"), instana.Field("c", "3"))), `a:1 AND b:2 AND c:3`},
+		"single clause":       {instana.And(instana.Field("a", "1"), instana.Or(instana.Field("b", "2"))), `a:1 AND b:2`},
+		"empty clauses":       {instana.And(instana.And(), instana.Field("a", "1")), `a:1`},
+		"not":                 {instana.Not(instana.Field("entity.zone", "test")), `NOT entity.zone:test`},
+		"not or":              {instana.Not(instana.Or(instana.Field("a", "1"), instana.Field("b", "2"))), `NOT (a:1 OR b:2)`},
+		"group":               {instana.Group(instana.Field("a", "1")), `(a:1)`},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			actual := tc.query.String()
+			if actual != tc.expected {
+				t.Errorf("String() = %s, want %s", actual, tc.expected)
+			}
+		})
+	}
+}
+
+type searchFields []openapi.SearchFieldResult
+
+func (s searchFields) ListPluginsContext(ctx context.Context) ([]openapi.PluginResult, error) {
+	return nil, nil
+}
+
+func (s searchFields) ListCatalogMetricsContext(ctx context.Context, plugin string) ([]openapi.MetricInstance, error) {
+	return nil, nil
+}
+
+func (s searchFields) ListSearchFieldsContext(ctx context.Context) ([]openapi.SearchFieldResult, error) {
+	return s, nil
+}
+
+func Test_ValidateQuery(t *testing.T) {
+	t.Parallel()
+
+	catalog := searchFields{{Keyword: "entity.zone"}, {Keyword: "entity.type"}}
+
+	td := map[string]struct {
+		query instana.Query
+		valid bool
+	}{
+		"known keywords":  {instana.And(instana.Field("entity.type", "host"), instana.Not(instana.Field("entity.zone", "x"))), true},
+		"free text":       {instana.Term{Value: "checkout"}, true},
+		"unknown keyword": {instana.And(instana.Field("entity.type", "host"), instana.Field("entity.zoen", "x")), false},
+		"nested in group": {instana.Group(instana.Or(instana.Field("entity.tpye", "host"))), false},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			err := instana.ValidateQuery(context.Background(), catalog, tc.query)
+			if tc.valid && err != nil {
+				t.Errorf("ValidateQuery() error = %v", err)
+			}
+			if !tc.valid && !errors.Is(err, instana.ErrInvalidQuery) {
+				t.Errorf("ValidateQuery() error = %v, want %v", err, instana.ErrInvalidQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package instana
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// Transform converts a series, for example a counter into its rate.
+type Transform func(Series) Series
+
+// Rate returns the rate of increase of a monotonic counter per unit, e.g. time.Second. Each point is the
+// increase since the previous point divided by the actual time between them, so irregular timestamps don't
+// skew the rate. A decrease is a counter reset, e.g. a process restart, and counts the new value as the
+// increase since the counter restarted from zero. The first point has no rate and is omitted, NaN and
+// infinite values are NaN and do not start the next interval.
+func Rate(s Series, unit time.Duration) Series {
+	return delta(s, unit, true)
+}
+
+// Derivative returns the change of a gauge per unit, e.g. time.Second. Unlike Rate a decrease is a
+// negative change rather than a reset.
+func Derivative(s Series, unit time.Duration) Series {
+	return delta(s, unit, false)
+}
+
+func delta(s Series, unit time.Duration, counter bool) Series {
+	var out = make(Series, 0, len(s))
+	var prev *Point
+	for i := range s {
+		p := s[i]
+		if !isFinite(p.Value) {
+			out = append(out, Point{Timestamp: p.Timestamp, Value: math.NaN()})
+			continue
+		}
+		if prev == nil {
+			prev = &s[i]
+			continue
+		}
+
+		dt := p.Timestamp - prev.Timestamp
+		if dt <= 0 {
+			continue
+		}
+		d := p.Value - prev.Value
+		if counter && d < 0 {
+			d = p.Value
+		}
+		out = append(out, Point{Timestamp: p.Timestamp, Value: d / (float64(dt) * float64(time.Millisecond) / float64(unit))})
+		prev = &s[i]
+	}
+	return out
+}
+
+// Chain returns a transform applying each of transforms in order, nil transforms are skipped.
+func Chain(transforms ...Transform) Transform {
+	var chained []Transform
+	for _, t := range transforms {
+		if t != nil {
+			chained = append(chained, t)
+		}
+	}
+	if len(chained) == 0 {
+		return nil
+	}
+	return func(s Series) Series {
+		for _, t := range chained {
+			s = t(s)
+		}
+		return s
+	}
+}
+
+// ParseTransform returns the transform called name: "none" (or empty) leaves series unchanged, "rate" is
+// Rate and "derivative" is Derivative, both per unit.
+func ParseTransform(name string, unit time.Duration) (Transform, error) {
+	switch name {
+	case "none", "":
+		return nil, nil
+	case "rate":
+		return func(s Series) Series { return Rate(s, unit) }, nil
+	case "derivative":
+		return func(s Series) Series { return Derivative(s, unit) }, nil
+	}
+	return nil, fmt.Errorf("invalid transform %q, must be one of none, rate or derivative", name)
+}
+
+// ParseRateUnit parses the unit rates are normalised to: "second" (or empty) or "rollup", the rollup in
+// seconds. Per rollup rates are the increase per data point, e.g. calls per minute with a 60s rollup.
+func ParseRateUnit(s string, rollup int64) (time.Duration, error) {
+	switch s {
+	case "second", "":
+		return time.Second, nil
+	case "rollup":
+		return time.Duration(rollup) * time.Second, nil
+	}
+	return 0, fmt.Errorf("invalid rate unit %q, must be second or rollup", s)
+}
+
+// TransformItems returns copies of items with metric replaced by its transformed series, other metrics
+// are shared with items. A nil transform returns items unchanged.
+func TransformItems(items []openapi.MetricItem, metric string, transform Transform) []openapi.MetricItem {
+	if transform == nil {
+		return items
+	}
+
+	var transformed = make([]openapi.MetricItem, len(items))
+	for i, item := range items {
+		metrics := make(map[string][][]float64, len(item.Metrics))
+		for k, v := range item.Metrics {
+			metrics[k] = v
+		}
+		if _, ok := item.Metrics[metric]; ok {
+			metrics[metric] = transform(SeriesOf(item, metric)).Points()
+		}
+		item.Metrics = metrics
+		transformed[i] = item
+	}
+	return transformed
+}
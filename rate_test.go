@@ -0,0 +1,117 @@
+package instana_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// series returns a series of [seconds, value] pairs.
+func series(points ...[2]float64) instana.Series {
+	var s instana.Series
+	for _, p := range points {
+		s = append(s, instana.Point{Timestamp: int64(p[0] * 1000), Value: p[1]})
+	}
+	return s
+}
+
+func Test_Rate(t *testing.T) {
+	t.Parallel()
+
+	nan := math.NaN()
+	td := map[string]struct {
+		input    instana.Series
+		unit     time.Duration
+		counter  bool
+		expected instana.Series
+	}{
+		"per second":         {series([2]float64{0, 10}, [2]float64{10, 110}, [2]float64{20, 160}), time.Second, true, series([2]float64{10, 10}, [2]float64{20, 5})},
+		"per rollup":         {series([2]float64{0, 10}, [2]float64{60, 130}), time.Minute, true, series([2]float64{60, 120})},
+		"irregular deltas":   {series([2]float64{0, 0}, [2]float64{1, 10}, [2]float64{5, 50}), time.Second, true, series([2]float64{1, 10}, [2]float64{5, 10})},
+		"counter reset":      {series([2]float64{0, 100}, [2]float64{10, 200}, [2]float64{20, 30}), time.Second, true, series([2]float64{10, 10}, [2]float64{20, 3})},
+		"derivative":         {series([2]float64{0, 100}, [2]float64{10, 200}, [2]float64{20, 30}), time.Second, false, series([2]float64{10, 10}, [2]float64{20, -17})},
+		"non finite":         {series([2]float64{0, 0}, [2]float64{10, nan}, [2]float64{20, 40}), time.Second, true, series([2]float64{10, nan}, [2]float64{20, 2})},
+		"duplicate":          {series([2]float64{0, 0}, [2]float64{0, 5}, [2]float64{10, 20}), time.Second, true, series([2]float64{10, 2})},
+		"single point":       {series([2]float64{0, 10}), time.Second, true, instana.Series{}},
+		"empty":              {nil, time.Second, true, instana.Series{}},
+		"leading non finite": {series([2]float64{0, nan}, [2]float64{10, 10}, [2]float64{20, 30}), time.Second, false, series([2]float64{0, nan}, [2]float64{20, 2})},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var actual instana.Series
+			if tc.counter {
+				actual = instana.Rate(tc.input, tc.unit)
+			} else {
+				actual = instana.Derivative(tc.input, tc.unit)
+			}
+			if !cmp.Equal(actual, tc.expected, cmpopts.EquateNaNs()) {
+				t.Errorf("Rate() -got/+want:\n%s", cmp.Diff(actual, tc.expected, cmpopts.EquateNaNs()))
+			}
+		})
+	}
+}
+
+func Test_TransformItems(t *testing.T) {
+	t.Parallel()
+
+	items := []openapi.MetricItem{{
+		Host:    "host-1",
+		Metrics: map[string][][]float64{CpuUser: {{0, 0}, {10000, 100}}, "cpu.sys": {{0, 1}}},
+	}}
+	transform, err := instana.ParseTransform("rate", time.Second)
+	if err != nil {
+		t.Fatalf("ParseTransform() err = %v, want nil", err)
+	}
+
+	actual := instana.TransformItems(items, CpuUser, transform)
+	if !cmp.Equal(actual[0].Metrics[CpuUser], [][]float64{{10000, 10}}) {
+		t.Errorf("Metrics[cpu.user] = %v, want [[10000 10]]", actual[0].Metrics[CpuUser])
+	}
+	if actual[0].Host != "host-1" || len(actual[0].Metrics["cpu.sys"]) != 1 {
+		t.Errorf("TransformItems() = %+v, want other fields unchanged", actual[0])
+	}
+	if len(items[0].Metrics[CpuUser]) != 2 {
+		t.Errorf("TransformItems() modified its input: %v", items[0].Metrics[CpuUser])
+	}
+}
+
+func Test_ParseTransform_errors(t *testing.T) {
+	t.Parallel()
+
+	_, err := instana.ParseTransform("integral", time.Second)
+	if err == nil {
+		t.Errorf("ParseTransform(integral) err = nil, want error")
+	}
+	_, err = instana.ParseRateUnit("minute", 60)
+	if err == nil {
+		t.Errorf("ParseRateUnit(minute) err = nil, want error")
+	}
+	unit, err := instana.ParseRateUnit("rollup", 60)
+	if err != nil || unit != time.Minute {
+		t.Errorf("ParseRateUnit(rollup) = %v, %v, want 1m0s, nil", unit, err)
+	}
+}
+
+func Test_Chain(t *testing.T) {
+	t.Parallel()
+
+	input := series([2]float64{0, 0}, [2]float64{2, 20})
+	chained := instana.Chain(nil, instana.FillLinear.Transform(1), func(s instana.Series) instana.Series { return instana.Rate(s, time.Second) })
+	expected := series([2]float64{1, 10}, [2]float64{2, 10})
+
+	actual := chained(input)
+	if !cmp.Equal(actual, expected) {
+		t.Errorf("Chain() -got/+want:\n%s", cmp.Diff(actual, expected))
+	}
+	if instana.Chain(nil, nil) != nil {
+		t.Errorf("Chain(nil, nil) != nil, want nil")
+	}
+}
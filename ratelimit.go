@@ -0,0 +1,101 @@
+package instana
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitReserve is the number of calls per rate limit window left for other users of the same token.
+const DefaultRateLimitReserve = 25
+
+// RateLimiter paces calls to the Instana API using the X-Ratelimit-Remaining and X-Ratelimit-Reset
+// headers from previous responses. The remaining quota is spread evenly over the time left until the
+// reset and callers block once the quota, less the reserve, is exhausted. It is safe for concurrent use.
+type RateLimiter struct {
+	mu        sync.Mutex
+	reserve   int64
+	known     bool
+	remaining int64
+	reset     time.Time
+	next      time.Time
+}
+
+// NewRateLimiter builds a rate limiter that leaves reserve calls unused in each rate limit window.
+func NewRateLimiter(reserve int64) *RateLimiter {
+	return &RateLimiter{reserve: reserve}
+}
+
+// Wait blocks until the next call may be issued or ctx is done.
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	delay := rl.schedule(time.Now())
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// schedule reserves a slot for a call and returns how long the caller must wait before issuing it.
+func (rl *RateLimiter) schedule(now time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if !rl.known {
+		return 0
+	}
+
+	if !now.Before(rl.reset) {
+		// the window has reset, the next response will tell us the new quota.
+		rl.known = false
+		return 0
+	}
+
+	budget := rl.remaining - rl.reserve
+	if budget <= 0 {
+		delay := rl.reset.Sub(now)
+		log.Printf("rate limit exhausted, waiting %v for reset\n", delay.Round(time.Second))
+		return delay
+	}
+
+	start := now
+	if rl.next.After(start) {
+		start = rl.next
+	}
+	rl.next = start.Add(rl.reset.Sub(now) / time.Duration(budget))
+	rl.remaining--
+
+	return start.Sub(now)
+}
+
+// Update records the rate limit state reported by resp. Responses without rate limit headers are ignored.
+func (rl *RateLimiter) Update(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	remaining, err := strconv.ParseInt(resp.Header.Get("X-Ratelimit-Remaining"), 10, 64)
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.known = true
+	rl.remaining = remaining
+	rl.reset = time.Unix(reset, 0)
+}
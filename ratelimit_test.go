@@ -0,0 +1,98 @@
+package instana_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nfisher/instana-crib"
+)
+
+func rateLimitResponse(remaining int64, reset time.Time) *http.Response {
+	h := http.Header{}
+	h.Set("X-Ratelimit-Remaining", strconv.FormatInt(remaining, 10))
+	h.Set("X-Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return &http.Response{Header: h}
+}
+
+func Test_RateLimiter_Wait_unknown_quota(t *testing.T) {
+	t.Parallel()
+
+	rl := instana.NewRateLimiter(0)
+	rl.Update(&http.Response{Header: http.Header{}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 10; i++ {
+		err := rl.Wait(ctx)
+		if err != nil {
+			t.Fatalf("Wait() call %d error = %v, want nil", i, err)
+		}
+	}
+}
+
+func Test_RateLimiter_Wait_blocks_when_exhausted(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		reserve   int64
+		remaining int64
+	}{
+		"no calls remaining":        {0, 0},
+		"only reserve remaining":    {25, 25},
+		"reserve exceeds remaining": {25, 10},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rl := instana.NewRateLimiter(tc.reserve)
+			rl.Update(rateLimitResponse(tc.remaining, time.Now().Add(time.Hour)))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := rl.Wait(ctx)
+			if err != context.DeadlineExceeded {
+				t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+func Test_RateLimiter_Wait_paces_remaining_calls(t *testing.T) {
+	t.Parallel()
+
+	rl := instana.NewRateLimiter(0)
+	rl.Update(rateLimitResponse(2, time.Now().Add(time.Hour)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := rl.Wait(ctx)
+	if err != nil {
+		t.Fatalf("first Wait() error = %v, want nil", err)
+	}
+
+	err = rl.Wait(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("second Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func Test_RateLimiter_Wait_after_reset(t *testing.T) {
+	t.Parallel()
+
+	rl := instana.NewRateLimiter(0)
+	rl.Update(rateLimitResponse(0, time.Now().Add(-time.Second)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := rl.Wait(ctx)
+	if err != nil {
+		t.Errorf("Wait() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,201 @@
+package instana
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// redacted replaces the authorization header in recorded fixtures.
+const redacted = "apiToken REDACTED"
+
+// WithRecording saves every request and response to a fixture file in dir, see RecordingTransport.
+func WithRecording(dir string) ClientOption {
+	return func(o *clientOptions) {
+		o.record = dir
+	}
+}
+
+// WithReplay serves responses from the fixture files in dir without network access, see ReplayTransport.
+func WithReplay(dir string) ClientOption {
+	return func(o *clientOptions) {
+		o.replay = dir
+	}
+}
+
+type fixtureRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type fixtureResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+type fixture struct {
+	Request  fixtureRequest  `json:"request"`
+	Response fixtureResponse `json:"response"`
+}
+
+// RecordingTransport saves each request and response to a fixture file in Dir with the API token
+// redacted. The fixtures can be served by ReplayTransport.
+type RecordingTransport struct {
+	Dir  string
+	Next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// the request must not be modified, send a clone with a fresh copy of the body instead.
+	next := req.Clone(req.Context())
+	if reqBody != nil {
+		next.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		next.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(reqBody)), nil
+		}
+	}
+
+	resp, err := t.Next.RoundTrip(next)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := req.Header.Clone()
+	if header.Get("Authorization") != "" {
+		header.Set("Authorization", redacted)
+	}
+
+	f := fixture{
+		Request: fixtureRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: header,
+			Body:   string(reqBody),
+		},
+		Response: fixtureResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       string(respBody),
+		},
+	}
+
+	b, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(t.Dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(t.Dir, fixtureName(req, reqBody)), b, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record fixture: %w", err)
+	}
+
+	return resp, nil
+}
+
+// ReplayTransport serves responses from fixture files saved by RecordingTransport. Requests are matched
+// on method, path, query and body, the host and headers are ignored.
+type ReplayTransport struct {
+	Dir string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Join(t.Dir, fixtureName(req, reqBody))
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s: %w", req.Method, req.URL.RequestURI(), err)
+	}
+
+	var f fixture
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", name, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.StatusCode, http.StatusText(f.Response.StatusCode)),
+		StatusCode:    f.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Response.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(f.Response.Body)),
+		ContentLength: int64(len(f.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// requestBody returns the body of req without modifying req. It reads a copy from GetBody when set and
+// otherwise consumes req.Body, which is closed either way as required of a RoundTripper.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+
+	var body io.ReadCloser = req.Body
+	if req.GetBody != nil {
+		copied, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer copied.Close()
+		body = copied
+	}
+	return ioutil.ReadAll(body)
+}
+
+// readBody reads and replaces body so it can be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// fixtureName derives a stable file name from the parts of the request that select the response.
+func fixtureName(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", req.Method, req.URL.Path, req.URL.Query().Encode())
+	h.Write(body)
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	return fmt.Sprintf("%s-%s-%s.json", strings.ToLower(req.Method), path.Base(req.URL.Path), sum[:16])
+}
@@ -0,0 +1,94 @@
+package instana_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_Recording_and_Replay(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	srv, calls := statusSequence(http.StatusOK)
+
+	recorder, err := instana.NewClient(srv.URL, "secret-token", instana.WithRecording(dir))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	recorded, err := recorder.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{CpuUser}, 1, 60000, 1601553600000)
+	if err != nil {
+		t.Fatalf("ListMetricsContext() error = %v", err)
+	}
+	srv.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("fixtures = %v, want 1", len(files))
+	}
+	b, _ := ioutil.ReadFile(files[0])
+	if strings.Contains(string(b), "secret-token") {
+		t.Error("fixture contains the API token")
+	}
+
+	replayer, err := instana.NewClient("https://replay.invalid", "", instana.WithReplay(dir), instana.WithRetryPolicy(instana.NoRetry))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	replayed, err := replayer.ListMetricsContext(context.Background(), "entity.zone:test", "host", []string{CpuUser}, 1, 60000, 1601553600000)
+	if err != nil {
+		t.Fatalf("replayed ListMetricsContext() error = %v", err)
+	}
+	if len(replayed) != len(recorded) || replayed[0].SnapshotId != recorded[0].SnapshotId {
+		t.Errorf("replayed = %v, want %v", replayed, recorded)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %v, want 1", *calls)
+	}
+
+	_, err = replayer.ListMetricsContext(context.Background(), "entity.zone:other", "host", []string{CpuUser}, 1, 60000, 1601553600000)
+	if !errors.Is(err, instana.ErrTransport) {
+		t.Errorf("missing fixture error = %v, want %v", err, instana.ErrTransport)
+	}
+}
+
+type echoTransport struct{}
+
+func (echoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(bytes.NewReader(b)), Request: req}, nil
+}
+
+func Test_RecordingTransport_does_not_modify_request(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodPost, "https://unit.invalid/api/infrastructure-monitoring/metrics", strings.NewReader(`{"rollup":1}`))
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	body := req.Body
+
+	transport := &instana.RecordingTransport{Dir: t.TempDir(), Next: echoTransport{}}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	if string(b) != `{"rollup":1}` {
+		t.Errorf("next transport body = %s, want {\"rollup\":1}", b)
+	}
+	if req.Body != body {
+		t.Error("RoundTrip() replaced the request body")
+	}
+}
@@ -0,0 +1,181 @@
+package instana
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how calls that fail with a rate limit, transient server or transport error are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first, values below 1 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it doubles with each subsequent attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential delay, 0 leaves it uncapped. A Retry-After header from the server takes
+	// precedence.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by NewClient unless WithRetryPolicy is supplied.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// NoRetry disables retries.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// Backoff returns the delay before the attempt following attempt, honouring a Retry-After header in resp.
+func (p RetryPolicy) Backoff(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp, time.Now()); ok {
+		return d
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// jitter within the upper half of the delay so concurrent callers don't retry in lock step.
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter parses the Retry-After header which is either a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err == nil {
+		if secs < 0 {
+			secs = 0
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// isRetryable reports whether a call that returned resp and err should be attempted again.
+func isRetryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if resp == nil {
+		// transport errors such as DNS failures or reset connections.
+		return err != nil
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type callStatsKey struct{}
+
+// CallStats accumulates the number of calls and attempts made with a context returned by WithCallStats.
+// It is safe for concurrent use.
+type CallStats struct {
+	mu       sync.Mutex
+	calls    int
+	attempts int
+}
+
+// WithCallStats returns a context that records the calls and attempts made with it in stats.
+func WithCallStats(ctx context.Context, stats *CallStats) context.Context {
+	return context.WithValue(ctx, callStatsKey{}, stats)
+}
+
+// Calls returns the number of high-level calls made.
+func (s *CallStats) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// Attempts returns the total number of HTTP attempts made across all calls.
+func (s *CallStats) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+func recordAttempts(ctx context.Context, attempts int) {
+	stats, ok := ctx.Value(callStatsKey{}).(*CallStats)
+	if !ok || stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.calls++
+	stats.attempts += attempts
+}
+
+// call issues fn with rate limiting and retries according to the client's policy. A failure of the final
+// attempt is returned as an *APIError describing op.
+func (api *InfraQueryAPI) call(ctx context.Context, op string, fn func(ctx context.Context) (*http.Response, error)) error {
+	ctx = api.withAuth(ctx)
+
+	var attempt int
+	for {
+		attempt++
+		err := api.limiter.Wait(ctx)
+		if err != nil {
+			recordAttempts(ctx, attempt-1)
+			return newAPIError(op, attempt-1, nil, err)
+		}
+
+		resp, err := fn(ctx)
+		api.limiter.Update(resp)
+		if err == nil {
+			recordAttempts(ctx, attempt)
+			return nil
+		}
+		if attempt >= api.retry.MaxAttempts || !isRetryable(ctx, resp, err) {
+			recordAttempts(ctx, attempt)
+			return newAPIError(op, attempt, resp, err)
+		}
+
+		timer := time.NewTimer(api.retry.Backoff(attempt, resp))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			recordAttempts(ctx, attempt)
+			return newAPIError(op, attempt, nil, fmt.Errorf("%w waiting to retry after: %v", ctx.Err(), err))
+		case <-timer.C:
+		}
+	}
+}
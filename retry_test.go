@@ -0,0 +1,149 @@
+package instana_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nfisher/instana-crib"
+)
+
+const metricsBody = `{"items":[{"snapshotId":"abc","plugin":"host","metrics":{"cpu.user":[[1601553600000,0.5]]}}]}`
+
+func statusSequence(statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		status := statuses[len(statuses)-1]
+		if int(n) <= len(statuses) {
+			status = statuses[n-1]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(metricsBody))
+		}
+	}))
+	return srv, &calls
+}
+
+func Test_ListMetricsContext_retries(t *testing.T) {
+	t.Parallel()
+
+	policy := instana.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	td := map[string]struct {
+		statuses []int
+		attempts int
+		hasError bool
+	}{
+		"success first time":         {[]int{200}, 1, false},
+		"service unavailable":        {[]int{503, 200}, 2, false},
+		"rate limited":               {[]int{429, 502, 200}, 3, false},
+		"gives up after max":         {[]int{500}, 3, true},
+		"bad request is not retried": {[]int{400}, 1, true},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, calls := statusSequence(tc.statuses...)
+			defer srv.Close()
+
+			api, err := instana.NewClient(srv.URL, "token", instana.WithRetryPolicy(policy))
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			var stats instana.CallStats
+			ctx := instana.WithCallStats(context.Background(), &stats)
+			_, err = api.ListMetricsContext(ctx, "entity.zone:test", "host", []string{CpuUser}, 1, 60000, 0)
+			if (err != nil) != tc.hasError {
+				t.Errorf("ListMetricsContext() error = %v, want error %v", err, tc.hasError)
+			}
+			if stats.Attempts() != tc.attempts {
+				t.Errorf("Attempts() = %v, want %v", stats.Attempts(), tc.attempts)
+			}
+			if int(atomic.LoadInt32(calls)) != tc.attempts {
+				t.Errorf("server calls = %v, want %v", atomic.LoadInt32(calls), tc.attempts)
+			}
+			if stats.Calls() != 1 {
+				t.Errorf("Calls() = %v, want 1", stats.Calls())
+			}
+		})
+	}
+}
+
+func Test_ListMetricsContext_cancelled_during_backoff(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := statusSequence(503)
+	defer srv.Close()
+
+	policy := instana.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute}
+	api, err := instana.NewClient(srv.URL, "token", instana.WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = api.ListMetricsContext(ctx, "entity.zone:test", "host", []string{CpuUser}, 1, 60000, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ListMetricsContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !errors.Is(err, instana.ErrTransport) {
+		t.Errorf("ListMetricsContext() error = %v, want %v", err, instana.ErrTransport)
+	}
+}
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	t.Parallel()
+
+	policy := instana.RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+
+	td := map[string]struct {
+		attempt int
+		header  string
+		min     time.Duration
+		max     time.Duration
+	}{
+		"first retry":         {1, "", 50 * time.Millisecond, 100 * time.Millisecond},
+		"second retry":        {2, "", 100 * time.Millisecond, 200 * time.Millisecond},
+		"capped":              {4, "", 150 * time.Millisecond, 300 * time.Millisecond},
+		"retry after seconds": {1, "7", 7 * time.Second, 7 * time.Second},
+		"retry after invalid": {1, "soon", 50 * time.Millisecond, 100 * time.Millisecond},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tc.header != "" {
+				resp.Header.Set("Retry-After", tc.header)
+			}
+			actual := policy.Backoff(tc.attempt, resp)
+			if actual < tc.min || actual > tc.max {
+				t.Errorf("Backoff(%v) = %v, want between %v and %v", tc.attempt, actual, tc.min, tc.max)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_Backoff_uncapped(t *testing.T) {
+	t.Parallel()
+
+	policy := instana.RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond}
+	actual := policy.Backoff(4, nil)
+	if actual < 400*time.Millisecond || actual > 800*time.Millisecond {
+		t.Errorf("Backoff(4) = %v, want between 400ms and 800ms", actual)
+	}
+}
@@ -0,0 +1,135 @@
+package instana
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// Point is a value at an epoch timestamp in milliseconds.
+type Point struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Time returns the timestamp of the point in UTC.
+func (p Point) Time() time.Time {
+	return time.Unix(0, p.Timestamp*int64(time.Millisecond)).UTC()
+}
+
+// MarshalJSON encodes the point as {"timestamp": ts, "value": v} with NaN and infinite values as null,
+// which JSON can't represent.
+func (p Point) MarshalJSON() ([]byte, error) {
+	var v interface{}
+	if isFinite(p.Value) {
+		v = p.Value
+	}
+	return json.Marshal(struct {
+		Timestamp int64       `json:"timestamp"`
+		Value     interface{} `json:"value"`
+	}{p.Timestamp, v})
+}
+
+// UnmarshalJSON decodes a point encoded by MarshalJSON, a null value is NaN.
+func (p *Point) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Timestamp int64    `json:"timestamp"`
+		Value     *float64 `json:"value"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+	p.Timestamp = raw.Timestamp
+	p.Value = math.NaN()
+	if raw.Value != nil {
+		p.Value = *raw.Value
+	}
+	return nil
+}
+
+// Series is a time series ordered by timestamp. Unlike clock-time keys, timestamps from different days
+// never collide.
+type Series []Point
+
+// SeriesOf returns the metric series of item ordered by timestamp with timestamps truncated to the second.
+func SeriesOf(item openapi.MetricItem, metric string) Series {
+	return NewSeries(item.Metrics[metric])
+}
+
+// NewSeries returns the series of [timestamp, value] points ordered by timestamp with timestamps truncated
+// to the second.
+func NewSeries(points [][]float64) Series {
+	var series = make(Series, 0, len(points))
+	for _, m := range points {
+		series = append(series, Point{Timestamp: alignSecond(m[0]), Value: m[1]})
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Timestamp < series[j].Timestamp })
+	return series
+}
+
+// Timestamps returns the timestamps of the series.
+func (s Series) Timestamps() []int64 {
+	var ts = make([]int64, len(s))
+	for i, p := range s {
+		ts[i] = p.Timestamp
+	}
+	return ts
+}
+
+// Values returns the values of the series.
+func (s Series) Values() []float64 {
+	var values = make([]float64, len(s))
+	for i, p := range s {
+		values[i] = p.Value
+	}
+	return values
+}
+
+// Points returns the series in the [timestamp, value] form used by openapi.MetricItem.
+func (s Series) Points() [][]float64 {
+	var points = make([][]float64, len(s))
+	for i, p := range s {
+		points[i] = []float64{float64(p.Timestamp), p.Value}
+	}
+	return points
+}
+
+// Sum returns the per-timestamp sum of metric across items. Timestamps are truncated to the second so
+// series reported a few milliseconds apart line up. A NaN value makes the sum NaN, see Aggregate for
+// other aggregators and policies.
+func Sum(items []openapi.MetricItem, metric string) Series {
+	return Aggregate(items, metric, AggSum, PropagateNonFinite)
+}
+
+// column holds the values of every item at a timestamp.
+type column struct {
+	timestamp int64
+	values    []float64
+}
+
+// columns groups the values of metric across items by timestamp in ascending order.
+func columns(items []openapi.MetricItem, metric string) []column {
+	var byTimestamp = make(map[int64][]float64)
+	for _, item := range items {
+		for _, m := range item.Metrics[metric] {
+			ts := alignSecond(m[0])
+			byTimestamp[ts] = append(byTimestamp[ts], m[1])
+		}
+	}
+
+	var cols = make([]column, 0, len(byTimestamp))
+	for ts, values := range byTimestamp {
+		cols = append(cols, column{timestamp: ts, values: values})
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].timestamp < cols[j].timestamp })
+	return cols
+}
+
+// alignSecond truncates an epoch millisecond timestamp to the second.
+func alignSecond(ts float64) int64 {
+	return int64(ts) / 1000 * 1000
+}
@@ -0,0 +1,69 @@
+package instana_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+const day = 24 * 60 * 60
+
+func Test_Sum_across_days(t *testing.T) {
+	t.Parallel()
+
+	input := []openapi.MetricItem{
+		{Metrics: cpuUser(1601553600, []float64{0.1, 0.2})},
+		{Metrics: cpuUser(1601553600+day, []float64{0.3, 0.4})},
+	}
+	expected := instana.Series{
+		{Timestamp: 1601553600000, Value: 0.1},
+		{Timestamp: 1601553601000, Value: 0.2},
+		{Timestamp: (1601553600 + day) * 1000, Value: 0.3},
+		{Timestamp: (1601553601 + day) * 1000, Value: 0.4},
+	}
+
+	actual := instana.Sum(input, CpuUser)
+	if !cmp.Equal(actual, expected) {
+		t.Errorf("Sum() -got/+want:\n%s", cmp.Diff(actual, expected))
+	}
+}
+
+func Test_SeriesOf(t *testing.T) {
+	t.Parallel()
+
+	item := openapi.MetricItem{Metrics: map[string][][]float64{CpuUser: {{1601553601500, 2}, {1601553600200, 1}}}}
+	series := instana.SeriesOf(item, CpuUser)
+
+	if !cmp.Equal(series.Timestamps(), []int64{1601553600000, 1601553601000}) {
+		t.Errorf("Timestamps() = %v, want [1601553600000 1601553601000]", series.Timestamps())
+	}
+	if !cmp.Equal(series.Values(), []float64{1, 2}) {
+		t.Errorf("Values() = %v, want [1 2]", series.Values())
+	}
+	if !cmp.Equal(series.Points(), [][]float64{{1601553600000, 1}, {1601553601000, 2}}) {
+		t.Errorf("Points() = %v, want [[1601553600000 1] [1601553601000 2]]", series.Points())
+	}
+	if series[0].Time().Format("2006-01-02 15:04:05") != "2020-10-01 12:00:00" {
+		t.Errorf("Time() = %v, want 2020-10-01 12:00:00", series[0].Time())
+	}
+}
+
+func Test_ToPercentageHeatmap_across_days(t *testing.T) {
+	t.Parallel()
+
+	input := []openapi.MetricItem{
+		{Metrics: cpuUser(1601553600, []float64{0.5})},
+		{Metrics: cpuUser(1601553600+2*day, []float64{0.5})},
+	}
+	ph := instana.ToPercentageHeatmap(input, CpuUser)
+	if len(ph) != 2 {
+		t.Fatalf("len(ToPercentageHeatmap()) = %v, want 2", len(ph))
+	}
+
+	tab := instana.ToTabular(ph.Heatmap())
+	if tab[1][0] != "10-01 12:00:00" || tab[len(tab)-1][0] != "10-03 12:00:00" {
+		t.Errorf("ToTabular() groups = %v .. %v, want 10-01 12:00:00 .. 10-03 12:00:00", tab[1][0], tab[len(tab)-1][0])
+	}
+}
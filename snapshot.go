@@ -0,0 +1,251 @@
+package instana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// Snapshot data keys read by the EnrichedItem accessors.
+const (
+	// HostCPUCount is the number of logical CPUs of a host snapshot.
+	HostCPUCount = "cpu.count"
+	// HostMemoryTotal is the memory size of a host snapshot in bytes.
+	HostMemoryTotal = "memory.total"
+	// HostName is the hostname of a host snapshot.
+	HostName = "hostname"
+	// PodNamespace is the namespace of a Kubernetes pod snapshot.
+	PodNamespace = "namespace"
+	// PodNode is the node a Kubernetes pod snapshot is scheduled on.
+	PodNode = "nodeName"
+)
+
+// Snapshot is the full state of an entity. The generated SnapshotItem omits the plugin specific Data.
+type Snapshot struct {
+	openapi.SnapshotItem
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// SnapshotGetter retrieves the full data of a snapshot.
+type SnapshotGetter interface {
+	GetSnapshotContext(ctx context.Context, id string) (Snapshot, error)
+}
+
+var _ SnapshotGetter = (*InfraQueryAPI)(nil)
+var _ SnapshotGetter = (*MultiTenantClient)(nil)
+
+// GetSnapshot returns the snapshot with id.
+func (api *InfraQueryAPI) GetSnapshot(id string) (Snapshot, error) {
+	return api.GetSnapshotContext(context.Background(), id)
+}
+
+// GetSnapshotContext returns the snapshot with id using ctx for the request. An unknown or expired
+// snapshot returns an error matching ErrNotFound.
+func (api *InfraQueryAPI) GetSnapshotContext(ctx context.Context, id string) (Snapshot, error) {
+	var snapshot Snapshot
+	err := api.call(ctx, "retrieving snapshot "+id, func(ctx context.Context) (*http.Response, error) {
+		// the generated GetSnapshot decodes into SnapshotItem which drops the data.
+		return api.getJSON(ctx, "/api/infrastructure-monitoring/snapshots/"+url.PathEscape(id), &snapshot)
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// getJSON requests path relative to the base path and decodes the response into v.
+func (api *InfraQueryAPI) getJSON(ctx context.Context, path string, v interface{}) (*http.Response, error) {
+	cfg := api.client.GetConfig()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(cfg.BasePath, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cfg.DefaultHeader {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	if key, ok := ctx.Value(openapi.ContextAPIKey).(openapi.APIKey); ok {
+		req.Header.Set("Authorization", key.Prefix+" "+key.Key)
+	}
+
+	resp, err := cfg.HTTPClient.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode >= 300 {
+		return resp, &responseError{status: resp.Status, body: body}
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return resp, &responseError{status: err.Error(), body: body}
+	}
+	return resp, nil
+}
+
+// responseError is an unsuccessful or undecodable response, it exposes the body like the generated client's errors.
+type responseError struct {
+	status string
+	body   []byte
+}
+
+func (e *responseError) Error() string {
+	return e.status
+}
+
+// Body returns the response body.
+func (e *responseError) Body() []byte {
+	return e.body
+}
+
+// GetSnapshotContext returns the snapshot from the first tenant that has it. Snapshot IDs are unique
+// across units so at most one tenant is expected to succeed.
+func (m *MultiTenantClient) GetSnapshotContext(ctx context.Context, id string) (Snapshot, error) {
+	var err = fmt.Errorf("snapshot %s: %w", id, ErrNotFound)
+	for _, t := range m.tenants {
+		getter, ok := t.Client.(SnapshotGetter)
+		if !ok {
+			continue
+		}
+		snapshot, tenantErr := getter.GetSnapshotContext(ctx, id)
+		if tenantErr == nil {
+			return snapshot, nil
+		}
+		if !errors.Is(tenantErr, ErrNotFound) {
+			err = tenantErr
+		}
+	}
+	return Snapshot{}, err
+}
+
+// EnrichedItem is a MetricItem joined with the snapshot it was measured on.
+type EnrichedItem struct {
+	openapi.MetricItem
+	// Snapshot is empty if the snapshot no longer exists.
+	Snapshot Snapshot
+}
+
+// EnrichMetrics retrieves the snapshot of each item. Each snapshot is requested once however many items
+// share it. Items whose snapshot no longer exists are returned without data, any other error is returned
+// with no items.
+func EnrichMetrics(ctx context.Context, getter SnapshotGetter, items []openapi.MetricItem) ([]EnrichedItem, error) {
+	var snapshots = make(map[string]Snapshot)
+	var enriched = make([]EnrichedItem, 0, len(items))
+	for _, item := range items {
+		snapshot, ok := snapshots[item.SnapshotId]
+		if !ok && item.SnapshotId != "" {
+			var err error
+			snapshot, err = getter.GetSnapshotContext(ctx, item.SnapshotId)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			snapshots[item.SnapshotId] = snapshot
+		}
+		enriched = append(enriched, EnrichedItem{MetricItem: item, Snapshot: snapshot})
+	}
+	return enriched, nil
+}
+
+// Property returns the snapshot data value for key.
+func (e EnrichedItem) Property(key string) (interface{}, bool) {
+	v, ok := e.Snapshot.Data[key]
+	return v, ok
+}
+
+// CPUCount returns the number of CPUs of a host snapshot.
+func (e EnrichedItem) CPUCount() (int, bool) {
+	n, ok := e.number(HostCPUCount)
+	if !ok || n < 1 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// MemoryBytes returns the memory size of a host snapshot.
+func (e EnrichedItem) MemoryBytes() (float64, bool) {
+	return e.number(HostMemoryTotal)
+}
+
+// Namespace returns the namespace of a Kubernetes pod snapshot.
+func (e EnrichedItem) Namespace() string {
+	return e.text(PodNamespace)
+}
+
+// Node returns the node of a Kubernetes pod snapshot.
+func (e EnrichedItem) Node() string {
+	return e.text(PodNode)
+}
+
+// Cores returns metric scaled by the CPU count, converting a CPU fraction such as cpu.user into the number
+// of cores in use. It returns false if the CPU count is unknown.
+func (e EnrichedItem) Cores(metric string) ([][]float64, bool) {
+	n, ok := e.CPUCount()
+	if !ok {
+		return nil, false
+	}
+
+	var series = make([][]float64, 0, len(e.Metrics[metric]))
+	for _, point := range e.Metrics[metric] {
+		series = append(series, []float64{point[0], point[1] * float64(n)})
+	}
+	return series, true
+}
+
+// Title describes the item using its snapshot properties, falling back to the label.
+func (e EnrichedItem) Title() string {
+	var name = e.text(HostName)
+	if name == "" {
+		name = e.Label
+	}
+
+	var details []string
+	if ns := e.Namespace(); ns != "" {
+		details = append(details, "namespace "+ns)
+	}
+	if node := e.Node(); node != "" {
+		details = append(details, "node "+node)
+	}
+	if n, ok := e.CPUCount(); ok {
+		details = append(details, fmt.Sprintf("%d CPUs", n))
+	}
+	if bytes, ok := e.MemoryBytes(); ok {
+		details = append(details, fmt.Sprintf("%.1f GiB", bytes/(1<<30)))
+	}
+
+	if len(details) == 0 {
+		return name
+	}
+	return name + " (" + strings.Join(details, ", ") + ")"
+}
+
+func (e EnrichedItem) number(key string) (float64, bool) {
+	switch v := e.Snapshot.Data[key].(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (e EnrichedItem) text(key string) string {
+	s, _ := e.Snapshot.Data[key].(string)
+	return s
+}
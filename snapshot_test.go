@@ -0,0 +1,97 @@
+package instana_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/instanatest"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+func Test_InfraQueryAPI_GetSnapshot(t *testing.T) {
+	t.Parallel()
+
+	fixtures, err := instanatest.LoadFixtures("instanatest/testdata/fixtures.json")
+	if err != nil {
+		t.Fatalf("LoadFixtures() error = %v", err)
+	}
+	srv, _ := instanatest.NewServer("token", fixtures)
+	defer srv.Close()
+
+	api, err := instana.NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	snapshot, err := api.GetSnapshot("host-a")
+	if err != nil {
+		t.Fatalf("GetSnapshot() error = %v", err)
+	}
+	if snapshot.Label != "ip-10-0-0-1" || snapshot.Data["cpu.count"] != 8.0 {
+		t.Errorf("GetSnapshot() = %+v, want ip-10-0-0-1 with 8 CPUs", snapshot)
+	}
+
+	_, err = api.GetSnapshot("host-z")
+	var apiErr *instana.APIError
+	if !errors.Is(err, instana.ErrNotFound) || !errors.As(err, &apiErr) || len(apiErr.Body) == 0 {
+		t.Errorf("GetSnapshot(host-z) error = %v, want %v with body", err, instana.ErrNotFound)
+	}
+}
+
+func Test_EnrichMetrics(t *testing.T) {
+	t.Parallel()
+
+	fake := instanatest.NewFake(
+		instanatest.Snapshot{
+			SnapshotItem: openapi.SnapshotItem{SnapshotId: "host-a", Plugin: "host", Label: "host-a"},
+			Data:         map[string]interface{}{"hostname": "ip-10-0-0-1", "cpu.count": 4.0, "memory.total": 8589934592.0},
+		},
+		instanatest.Snapshot{
+			SnapshotItem: openapi.SnapshotItem{SnapshotId: "pod-a", Plugin: "kubernetesPod", Label: "checkout-5d8f"},
+			Data:         map[string]interface{}{"namespace": "shop", "nodeName": "node-1"},
+		},
+	)
+	items := []openapi.MetricItem{
+		{SnapshotId: "host-a", Label: "host-a", Metrics: map[string][][]float64{"cpu.user": {{1000, 0.5}, {2000, 0.25}}}},
+		{SnapshotId: "host-a", Label: "host-a"},
+		{SnapshotId: "pod-a", Label: "checkout-5d8f"},
+		{SnapshotId: "gone", Label: "expired"},
+	}
+
+	enriched, err := instana.EnrichMetrics(context.Background(), fake, items)
+	if err != nil {
+		t.Fatalf("EnrichMetrics() error = %v", err)
+	}
+	if len(fake.Calls()) != 3 {
+		t.Errorf("calls = %v, want 3", len(fake.Calls()))
+	}
+
+	titles := []string{
+		"ip-10-0-0-1 (4 CPUs, 8.0 GiB)",
+		"ip-10-0-0-1 (4 CPUs, 8.0 GiB)",
+		"checkout-5d8f (namespace shop, node node-1)",
+		"expired",
+	}
+	for i, e := range enriched {
+		if e.Title() != titles[i] {
+			t.Errorf("enriched[%d].Title() = %q, want %q", i, e.Title(), titles[i])
+		}
+	}
+
+	cores, ok := enriched[0].Cores("cpu.user")
+	if !ok || !cmp.Equal(cores, [][]float64{{1000, 2}, {2000, 1}}) {
+		t.Errorf("Cores() = %v, %v, want [[1000 2] [2000 1]]", cores, ok)
+	}
+	if _, ok := enriched[2].Cores("cpu.user"); ok {
+		t.Error("Cores() ok = true for a pod, want false")
+	}
+
+	fake.FailNext(errors.New("unavailable"))
+	_, err = instana.EnrichMetrics(context.Background(), fake, items)
+	if err == nil {
+		t.Error("EnrichMetrics() error = nil, want unavailable")
+	}
+}
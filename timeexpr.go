@@ -0,0 +1,172 @@
+package instana
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Day and Week extend the units of time.Duration for ParseLongDuration.
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+// localLayouts are the layouts interpreted in the location passed to ParseTime, omitting the clock
+// assumes midnight.
+var localLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"20060102",
+}
+
+// minEpochDigits is the number of digits of the smallest accepted epoch milliseconds, shorter numbers such
+// as the compact date 20200406 would otherwise be read as times in 1970.
+const minEpochDigits = 12
+
+// ParseTime parses a time expression. It accepts:
+//
+//   - RFC3339 with an offset, e.g. 2020-04-05T10:00:00+02:00 or 2020-04-05T08:00:00Z
+//   - a date with an optional clock in loc, e.g. 2020-04-05, 20200405 or 2020-04-05 10:00:00
+//   - either of the above followed by a time zone name, e.g. 2020-04-05 10:00 Europe/Berlin
+//   - epoch milliseconds of at least 12 digits, e.g. 1586080800000
+//   - now, today or yesterday with an optional offset, e.g. now-6h or today+9h, days start at
+//     midnight in loc
+//
+// A nil loc is UTC.
+func ParseTime(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	expr := strings.TrimSpace(s)
+	if expr == "" {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected a date, RFC3339, epoch milliseconds or now-<duration>", s)
+	}
+
+	if t, ok, err := parseRelative(expr, now, loc); ok {
+		return t, err
+	}
+
+	if len(expr) >= minEpochDigits && isDigits(expr) {
+		ms, err := strconv.ParseInt(expr, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid epoch milliseconds %q: %w", s, err)
+		}
+		return time.Unix(0, ms*int64(time.Millisecond)).In(loc), nil
+	}
+
+	if i := strings.LastIndexByte(expr, ' '); i > 0 && strings.IndexFunc(expr[i+1:], unicode.IsLetter) >= 0 {
+		zone, err := time.LoadLocation(expr[i+1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time zone in %q: %w", s, err)
+		}
+		expr, loc = strings.TrimSpace(expr[:i]), zone
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, expr); err == nil {
+		return t, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, expr, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a date, RFC3339, epoch milliseconds or now-<duration>", s)
+}
+
+// parseRelative parses now, today and yesterday with an optional offset. It returns false if expr
+// does not start with one of them.
+func parseRelative(expr string, now time.Time, loc *time.Location) (time.Time, bool, error) {
+	var base time.Time
+	var rest string
+	switch {
+	case strings.HasPrefix(expr, "now"):
+		base, rest = now.In(loc), expr[len("now"):]
+	case strings.HasPrefix(expr, "today"):
+		base, rest = midnight(now, loc), expr[len("today"):]
+	case strings.HasPrefix(expr, "yesterday"):
+		base, rest = midnight(now, loc).AddDate(0, 0, -1), expr[len("yesterday"):]
+	default:
+		return time.Time{}, false, nil
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return base, true, nil
+	}
+
+	sign := rest[0]
+	if sign != '+' && sign != '-' {
+		return time.Time{}, true, fmt.Errorf("invalid time %q, expected + or - after %s", expr, strings.TrimSuffix(expr, rest))
+	}
+	d, err := ParseLongDuration(strings.TrimSpace(rest[1:]))
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	if sign == '-' {
+		d = -d
+	}
+	return base.Add(d), true, nil
+}
+
+func midnight(now time.Time, loc *time.Location) time.Time {
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ParseLongDuration parses a duration like time.ParseDuration with the additional units d (24h) and
+// w (7d), e.g. 7d, 2w or 1d12h. Negative durations are rejected.
+func ParseLongDuration(s string) (time.Duration, error) {
+	if s == "" || s[0] == '-' || s[0] == '+' {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var total time.Duration
+	var rest = s
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration %q, missing unit", s)
+		}
+		j := i + strings.IndexFunc(rest[i:], func(r rune) bool { return unicode.IsDigit(r) || r == '.' })
+		if j < i {
+			j = len(rest)
+		}
+		number, unit := rest[:i], rest[i:j]
+		rest = rest[j:]
+
+		switch unit {
+		case "d", "w":
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+			}
+			scale := Day
+			if unit == "w" {
+				scale = Week
+			}
+			total += time.Duration(n * float64(scale))
+		default:
+			d, err := time.ParseDuration(number + unit)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q, valid units are \"ms\", \"s\", \"m\", \"h\", \"d\" and \"w\"", s)
+			}
+			total += d
+		}
+	}
+	return total, nil
+}
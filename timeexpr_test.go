@@ -0,0 +1,101 @@
+package instana_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_ParseTime(t *testing.T) {
+	t.Parallel()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	now := time.Date(2020, 4, 6, 15, 30, 0, 0, time.UTC)
+
+	td := map[string]struct {
+		input    string
+		loc      *time.Location
+		expected time.Time
+	}{
+		"date":                   {"2020-04-05", nil, time.Date(2020, 4, 5, 0, 0, 0, 0, time.UTC)},
+		"date in location":       {"2020-04-05", berlin, time.Date(2020, 4, 4, 22, 0, 0, 0, time.UTC)},
+		"date time":              {"2020-04-05 10:15:30", nil, time.Date(2020, 4, 5, 10, 15, 30, 0, time.UTC)},
+		"date time without secs": {"2020-04-05T10:15", nil, time.Date(2020, 4, 5, 10, 15, 0, 0, time.UTC)},
+		"named zone":             {"2020-04-05 10:00 Europe/Berlin", nil, time.Date(2020, 4, 5, 8, 0, 0, 0, time.UTC)},
+		"named zone overrides":   {"2020-04-05 10:00 UTC", berlin, time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)},
+		"RFC3339 offset":         {"2020-04-05T10:00:00-05:00", berlin, time.Date(2020, 4, 5, 15, 0, 0, 0, time.UTC)},
+		"RFC3339 zulu":           {"2020-04-05T10:00:00.5Z", nil, time.Date(2020, 4, 5, 10, 0, 0, 5e8, time.UTC)},
+		"epoch milliseconds":     {"1586080800000", nil, time.Date(2020, 4, 5, 10, 0, 0, 0, time.UTC)},
+		"compact date":           {"20200406", nil, time.Date(2020, 4, 6, 0, 0, 0, 0, time.UTC)},
+		"now":                    {"now", nil, now},
+		"now minus":              {"now-6h", nil, now.Add(-6 * time.Hour)},
+		"now minus days":         {"now - 1d12h", nil, now.Add(-36 * time.Hour)},
+		"today":                  {"today", nil, time.Date(2020, 4, 6, 0, 0, 0, 0, time.UTC)},
+		"today in location":      {"today", berlin, time.Date(2020, 4, 5, 22, 0, 0, 0, time.UTC)},
+		"today plus":             {"today+9h", nil, time.Date(2020, 4, 6, 9, 0, 0, 0, time.UTC)},
+		"yesterday":              {"yesterday", nil, time.Date(2020, 4, 5, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			actual, err := instana.ParseTime(tc.input, now, tc.loc)
+			if err != nil {
+				t.Fatalf("ParseTime(%q) error = %v", tc.input, err)
+			}
+			if !actual.Equal(tc.expected) {
+				t.Errorf("ParseTime(%q) = %v, want %v", tc.input, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func Test_ParseTime_errors(t *testing.T) {
+	t.Parallel()
+
+	inputs := []string{"", "2020-13-01", "now*2", "now-", "now-1y", "today-x", "2020-04-05 Mars/Olympus", "05/04/2020", "202004", "20201301"}
+	for _, input := range inputs {
+		_, err := instana.ParseTime(input, time.Now(), nil)
+		if err == nil {
+			t.Errorf("ParseTime(%q) error = nil, want error", input)
+		}
+	}
+}
+
+func Test_ParseLongDuration(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		input    string
+		expected time.Duration
+		hasError bool
+	}{
+		"go duration":   {"1h30m", 90 * time.Minute, false},
+		"days":          {"7d", 7 * instana.Day, false},
+		"weeks":         {"2w", 2 * instana.Week, false},
+		"fractional":    {"1.5d", 36 * time.Hour, false},
+		"mixed":         {"1w1d1h", 8*instana.Day + time.Hour, false},
+		"milliseconds":  {"250ms", 250 * time.Millisecond, false},
+		"missing unit":  {"7", 0, true},
+		"unknown unit":  {"1mo", 0, true},
+		"negative":      {"-1d", 0, true},
+		"empty":         {"", 0, true},
+		"leading unit":  {"d", 0, true},
+		"invalid float": {"1..5d", 0, true},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			actual, err := instana.ParseLongDuration(tc.input)
+			if (err != nil) != tc.hasError {
+				t.Errorf("ParseLongDuration(%q) error = %v, want error %v", tc.input, err, tc.hasError)
+			}
+			if actual != tc.expected {
+				t.Errorf("ParseLongDuration(%q) = %v, want %v", tc.input, actual, tc.expected)
+			}
+		})
+	}
+}
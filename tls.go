@@ -0,0 +1,71 @@
+package instana
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions configures how the client verifies the Instana API and authenticates itself to it.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to the system roots.
+	CAFile string `yaml:"caFile,omitempty"`
+	// CertFile is a PEM client certificate presented to the API for mutual TLS.
+	CertFile string `yaml:"certFile,omitempty"`
+	// KeyFile is the PEM private key for CertFile.
+	KeyFile string `yaml:"keyFile,omitempty"`
+	// InsecureSkipVerify disables certificate verification. The API token is still sent so only use it
+	// against units you control.
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+}
+
+// WithTLS configures certificate verification and client certificates for the client.
+func WithTLS(opts TLSOptions) ClientOption {
+	return func(o *clientOptions) {
+		o.tls = opts
+	}
+}
+
+// WithProxy routes requests through the proxy at proxyURL instead of the proxy from the environment.
+func WithProxy(proxyURL string) ClientOption {
+	return func(o *clientOptions) {
+		o.proxy = proxyURL
+	}
+}
+
+// config builds the tls.Config described by the options.
+func (opts TLSOptions) config() (*tls.Config, error) {
+	var cfg = &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be supplied together")
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
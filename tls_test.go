@@ -0,0 +1,77 @@
+package instana_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/nfisher/instana-crib"
+)
+
+func Test_NewClient_TLS(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	err := ioutil.WriteFile(caFile, caPEM, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	td := map[string]struct {
+		opts     instana.TLSOptions
+		hasError bool
+	}{
+		"unknown authority": {instana.TLSOptions{}, true},
+		"custom CA bundle":  {instana.TLSOptions{CAFile: caFile}, false},
+		"insecure opt-in":   {instana.TLSOptions{InsecureSkipVerify: true}, false},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			api, err := instana.NewClient(srv.URL, "token", instana.WithTLS(tc.opts), instana.WithRetryPolicy(instana.NoRetry))
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			_, err = api.ListSnapshotsContext(context.Background(), "", "host", 60000)
+			if (err != nil) != tc.hasError {
+				t.Errorf("ListSnapshotsContext() error = %v, want error %v", err, tc.hasError)
+			}
+			if tc.hasError && !errors.Is(err, instana.ErrTransport) {
+				t.Errorf("ListSnapshotsContext() error = %v, want %v", err, instana.ErrTransport)
+			}
+		})
+	}
+}
+
+func Test_NewClient_invalid_TLS_options(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]instana.TLSOptions{
+		"missing CA bundle": {CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"cert without key":  {CertFile: "client.pem"},
+		"key without cert":  {KeyFile: "client-key.pem"},
+		"missing key pair":  {CertFile: "missing.pem", KeyFile: "missing-key.pem"},
+	}
+
+	for name, opts := range td {
+		t.Run(name, func(t *testing.T) {
+			_, err := instana.NewClient("https://example.instana.io", "token", instana.WithTLS(opts))
+			if err == nil {
+				t.Errorf("NewClient() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package instana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// InfraTopology retrieves how snapshots relate to each other.
+type InfraTopology interface {
+	GetViewTreeContext(ctx context.Context) ([]openapi.TreeNode, error)
+	ListRelatedHostsContext(ctx context.Context, snapshotID string) ([]string, error)
+}
+
+var _ InfraTopology = (*InfraQueryAPI)(nil)
+
+// GetViewTreeContext returns the infrastructure view tree, each node's children are the snapshots it contains.
+func (api *InfraQueryAPI) GetViewTreeContext(ctx context.Context) ([]openapi.TreeNode, error) {
+	var result openapi.TreeNodeResult
+	err := api.call(ctx, "retrieving view tree", func(ctx context.Context) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		result, httpResp, err = api.client.InfrastructureResourcesApi.GetInfrastructureViewTree(ctx)
+		return httpResp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Tree, nil
+}
+
+// ListRelatedHostsContext returns the snapshot IDs of the hosts related to snapshotID.
+func (api *InfraQueryAPI) ListRelatedHostsContext(ctx context.Context, snapshotID string) ([]string, error) {
+	var hosts []string
+	err := api.call(ctx, "retrieving related hosts", func(ctx context.Context) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		hosts, httpResp, err = api.client.InfrastructureResourcesApi.GetRelatedHosts(ctx, snapshotID)
+		return httpResp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+// Edge kinds of a Graph.
+const (
+	// EdgeContains points from a view tree node to one of its children.
+	EdgeContains = "contains"
+	// EdgeRelatedHost points from a host to a snapshot it is related to.
+	EdgeRelatedHost = "related-host"
+)
+
+// GraphNode is a snapshot in a Graph.
+type GraphNode struct {
+	ID    string `json:"id"`
+	Type  string `json:"type,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// GraphEdge is a directed relationship between two snapshots.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// Graph is a directed graph of snapshots, edges point from the containing entity to the contained one
+// (e.g. host to container). Nodes and edges are listed in ID order so exports are stable.
+type Graph struct {
+	nodes    map[string]*GraphNode
+	children map[string]map[string]string
+	parents  map[string]map[string]string
+}
+
+// NewGraph returns an empty graph.
+func NewGraph() *Graph {
+	return &Graph{
+		nodes:    make(map[string]*GraphNode),
+		children: make(map[string]map[string]string),
+		parents:  make(map[string]map[string]string),
+	}
+}
+
+// GraphFromTree builds a graph from the view tree.
+func GraphFromTree(tree []openapi.TreeNode) *Graph {
+	g := NewGraph()
+	var add func(parent string, n openapi.TreeNode)
+	add = func(parent string, n openapi.TreeNode) {
+		g.AddNode(n.SnapshotId, n.Type)
+		if parent != "" {
+			g.AddEdge(parent, n.SnapshotId, EdgeContains)
+		}
+		for _, c := range n.Children {
+			add(n.SnapshotId, c)
+		}
+	}
+	for _, n := range tree {
+		add("", n)
+	}
+	return g
+}
+
+// BuildTopology builds a graph from the view tree and links each of the snapshots in related to its
+// hosts. Related host lookups cost an API call each so they are limited to the snapshots of interest.
+func BuildTopology(ctx context.Context, api InfraTopology, related ...string) (*Graph, error) {
+	tree, err := api.GetViewTreeContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g := GraphFromTree(tree)
+	for _, id := range related {
+		hosts, err := api.ListRelatedHostsContext(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			if host != id {
+				g.AddEdge(host, id, EdgeRelatedHost)
+			}
+		}
+	}
+	return g, nil
+}
+
+// AddNode adds a node or sets the type of an existing node if typ is not empty.
+func (g *Graph) AddNode(id string, typ string) {
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &GraphNode{ID: id}
+		g.nodes[id] = n
+	}
+	if typ != "" {
+		n.Type = typ
+	}
+}
+
+// AddEdge adds an edge of kind from one snapshot to another, adding missing nodes without a type.
+func (g *Graph) AddEdge(from string, to string, kind string) {
+	g.AddNode(from, "")
+	g.AddNode(to, "")
+	if g.children[from] == nil {
+		g.children[from] = make(map[string]string)
+	}
+	if g.parents[to] == nil {
+		g.parents[to] = make(map[string]string)
+	}
+	if _, ok := g.children[from][to]; !ok {
+		g.children[from][to] = kind
+		g.parents[to][from] = kind
+	}
+}
+
+// SetLabel sets the display label of a node, for example the label of its SnapshotItem.
+func (g *Graph) SetLabel(id string, label string) {
+	if n, ok := g.nodes[id]; ok {
+		n.Label = label
+	}
+}
+
+// Node returns the node with id.
+func (g *Graph) Node(id string) (GraphNode, bool) {
+	n, ok := g.nodes[id]
+	if !ok {
+		return GraphNode{}, false
+	}
+	return *n, true
+}
+
+// Nodes returns every node ordered by ID.
+func (g *Graph) Nodes() []GraphNode {
+	var nodes = make([]GraphNode, 0, len(g.nodes))
+	for _, id := range sortedKeys(g.nodes) {
+		nodes = append(nodes, *g.nodes[id])
+	}
+	return nodes
+}
+
+// Edges returns every edge ordered by source then target.
+func (g *Graph) Edges() []GraphEdge {
+	var edges []GraphEdge
+	for _, from := range sortedKeys(g.nodes) {
+		for _, to := range sortedStrings(g.children[from]) {
+			edges = append(edges, GraphEdge{From: from, To: to, Kind: g.children[from][to]})
+		}
+	}
+	return edges
+}
+
+// Children returns the IDs of the nodes id points to.
+func (g *Graph) Children(id string) []string {
+	return sortedStrings(g.children[id])
+}
+
+// Parents returns the IDs of the nodes pointing to id.
+func (g *Graph) Parents(id string) []string {
+	return sortedStrings(g.parents[id])
+}
+
+// Ancestors returns the IDs of every node with a path to id, nearest first.
+func (g *Graph) Ancestors(id string) []string {
+	return g.walk(id, g.parents)
+}
+
+// Descendants returns the IDs of every node reachable from id, nearest first. For a host these are the
+// containers, processes and pods running on it.
+func (g *Graph) Descendants(id string) []string {
+	return g.walk(id, g.children)
+}
+
+// walk returns the nodes reachable from id through adjacent in breadth first order.
+func (g *Graph) walk(id string, adjacent map[string]map[string]string) []string {
+	var visited = map[string]bool{id: true}
+	var found []string
+	var queue = []string{id}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, n := range sortedStrings(adjacent[next]) {
+			if !visited[n] {
+				visited[n] = true
+				found = append(found, n)
+				queue = append(queue, n)
+			}
+		}
+	}
+	return found
+}
+
+// GroupByType returns the IDs of the nodes of each type ordered by ID, nodes without a type are omitted.
+func (g *Graph) GroupByType(ids ...string) map[string][]string {
+	if len(ids) == 0 {
+		ids = sortedKeys(g.nodes)
+	}
+
+	var groups = make(map[string][]string)
+	for _, id := range ids {
+		n, ok := g.nodes[id]
+		if !ok || n.Type == "" {
+			continue
+		}
+		groups[n.Type] = append(groups[n.Type], id)
+	}
+	for _, group := range groups {
+		sort.Strings(group)
+	}
+	return groups
+}
+
+// Subgraph returns the graph of id, its ancestors and its descendants.
+func (g *Graph) Subgraph(id string) *Graph {
+	var keep = map[string]bool{id: true}
+	for _, n := range g.Ancestors(id) {
+		keep[n] = true
+	}
+	for _, n := range g.Descendants(id) {
+		keep[n] = true
+	}
+
+	sub := NewGraph()
+	for n := range keep {
+		if node, ok := g.nodes[n]; ok {
+			sub.nodes[n] = &GraphNode{ID: node.ID, Type: node.Type, Label: node.Label}
+		}
+	}
+	for _, e := range g.Edges() {
+		if keep[e.From] && keep[e.To] {
+			sub.AddEdge(e.From, e.To, e.Kind)
+		}
+	}
+	return sub
+}
+
+// MarshalJSON encodes the graph as its nodes and edges.
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	var edges = g.Edges()
+	if edges == nil {
+		edges = []GraphEdge{}
+	}
+	return json.Marshal(struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}{g.Nodes(), edges})
+}
+
+// WriteDOT writes the graph in Graphviz DOT format, related host edges are dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, n := range g.Nodes() {
+		label := n.ID
+		if n.Label != "" {
+			label = n.Label
+		}
+		if n.Type != "" {
+			label += "\n" + n.Type
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", dotQuote(n.ID), dotQuote(label))
+	}
+	for _, e := range g.Edges() {
+		style := ""
+		if e.Kind == EdgeRelatedHost {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s%s;\n", dotQuote(e.From), dotQuote(e.To), style)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote quotes s as a DOT string.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func sortedKeys(m map[string]*GraphNode) []string {
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStrings(m map[string]string) []string {
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
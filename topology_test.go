@@ -0,0 +1,130 @@
+package instana_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/instanatest"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+func topologyTree() []openapi.TreeNode {
+	return []openapi.TreeNode{
+		{SnapshotId: "host-a", Type: "host", Children: []openapi.TreeNode{
+			{SnapshotId: "docker-1", Type: "docker", Children: []openapi.TreeNode{
+				{SnapshotId: "jvm-1", Type: "jvmRuntimePlatform"},
+			}},
+			{SnapshotId: "docker-2", Type: "docker"},
+		}},
+		{SnapshotId: "host-b", Type: "host", Children: []openapi.TreeNode{
+			{SnapshotId: "pod-1", Type: "kubernetesPod"},
+		}},
+	}
+}
+
+func Test_Graph_traversal(t *testing.T) {
+	t.Parallel()
+
+	g := instana.GraphFromTree(topologyTree())
+
+	td := map[string]struct {
+		actual   []string
+		expected []string
+	}{
+		"descendants of host":  {g.Descendants("host-a"), []string{"docker-1", "docker-2", "jvm-1"}},
+		"descendants of leaf":  {g.Descendants("jvm-1"), nil},
+		"ancestors of jvm":     {g.Ancestors("jvm-1"), []string{"docker-1", "host-a"}},
+		"ancestors of root":    {g.Ancestors("host-b"), nil},
+		"children":             {g.Children("host-a"), []string{"docker-1", "docker-2"}},
+		"parents":              {g.Parents("pod-1"), []string{"host-b"}},
+		"unknown descendants":  {g.Descendants("missing"), nil},
+		"hosts":                {g.GroupByType()["host"], []string{"host-a", "host-b"}},
+		"containers on host a": {g.GroupByType(g.Descendants("host-a")...)["docker"], []string{"docker-1", "docker-2"}},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			if !cmp.Equal(tc.actual, tc.expected) {
+				t.Errorf("diff: %v", cmp.Diff(tc.actual, tc.expected))
+			}
+		})
+	}
+}
+
+func Test_Graph_export(t *testing.T) {
+	t.Parallel()
+
+	g := instana.GraphFromTree(topologyTree())
+	g.AddEdge("host-b", "docker-2", instana.EdgeRelatedHost)
+	g.SetLabel("host-b", `ip-10-0-0-2 "b"`)
+	sub := g.Subgraph("host-b")
+
+	var dot bytes.Buffer
+	err := sub.WriteDOT(&dot)
+	if err != nil {
+		t.Fatalf("WriteDOT() error = %v", err)
+	}
+	expected := `digraph topology {
+	rankdir=LR;
+	node [shape=box];
+	"docker-2" [label="docker-2\ndocker"];
+	"host-b" [label="ip-10-0-0-2 \"b\"\nhost"];
+	"pod-1" [label="pod-1\nkubernetesPod"];
+	"host-b" -> "docker-2" [style=dashed];
+	"host-b" -> "pod-1";
+}
+`
+	if dot.String() != expected {
+		t.Errorf("WriteDOT() diff: %v", cmp.Diff(dot.String(), expected))
+	}
+
+	b, err := json.Marshal(sub)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	expected = `{"nodes":[{"id":"docker-2","type":"docker"},{"id":"host-b","type":"host","label":"ip-10-0-0-2 \"b\""},{"id":"pod-1","type":"kubernetesPod"}],` +
+		`"edges":[{"from":"host-b","to":"docker-2","kind":"related-host"},{"from":"host-b","to":"pod-1","kind":"contains"}]}`
+	if string(b) != expected {
+		t.Errorf("json.Marshal() = %s, want %s", b, expected)
+	}
+}
+
+func Test_BuildTopology(t *testing.T) {
+	t.Parallel()
+
+	fixtures, err := instanatest.LoadFixtures("instanatest/testdata/fixtures.json")
+	if err != nil {
+		t.Fatalf("LoadFixtures() error = %v", err)
+	}
+	srv, _ := instanatest.NewServer("token", fixtures)
+	defer srv.Close()
+
+	api, err := instana.NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	g, err := instana.BuildTopology(context.Background(), api, "appdata-writer-1")
+	if err != nil {
+		t.Fatalf("BuildTopology() error = %v", err)
+	}
+	if !cmp.Equal(g.Descendants("host-a"), []string{"appdata-writer-1"}) {
+		t.Errorf("Descendants(host-a) = %v, want [appdata-writer-1]", g.Descendants("host-a"))
+	}
+	if !cmp.Equal(g.Descendants("host-b"), []string{"appdata-processor-1", "filler-1"}) {
+		t.Errorf("Descendants(host-b) = %v, want [appdata-processor-1 filler-1]", g.Descendants("host-b"))
+	}
+	expected := instana.GraphEdge{From: "host-a", To: "appdata-writer-1", Kind: instana.EdgeContains}
+	if edges := g.Edges(); len(edges) != 3 || edges[0] != expected {
+		t.Errorf("Edges() = %v, want 3 edges starting with %v", edges, expected)
+	}
+
+	_, err = instana.BuildTopology(context.Background(), api, "missing")
+	if err == nil {
+		t.Error("BuildTopology(missing) error = nil, want not found")
+	}
+}
@@ -0,0 +1,182 @@
+package instana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+// MaxPointsPerCall is the maximum number of data points per series returned by a single metrics call.
+const MaxPointsPerCall = 600
+
+// MaxRangeCalls is the maximum number of calls ListMetricsRange makes for a range, about 2% of the hourly
+// rate limit of an Instana unit.
+const MaxRangeCalls = 100
+
+// Rollups lists the rollups in seconds supported by the metrics API in ascending order.
+var Rollups = []int64{1, 5, 60, 300, 3600}
+
+// RollupForWindow returns the smallest rollup in seconds that covers windowSize (in ms) with a single call.
+func RollupForWindow(windowSize int64) (int64, error) {
+	rollup := windowSize / 1000 / MaxPointsPerCall
+	for _, r := range Rollups {
+		if rollup <= r {
+			return r, nil
+		}
+	}
+
+	return 0, errors.New("rollup is too large for API call, maximum call size is 25 days")
+}
+
+// AutoRollup returns the rollup for windowSize (in ms), falling back to the largest rollup for windows
+// that require more than one call.
+func AutoRollup(windowSize int64) int64 {
+	rollup, err := RollupForWindow(windowSize)
+	if err != nil {
+		return Rollups[len(Rollups)-1]
+	}
+	return rollup
+}
+
+// ValidateRollup returns an error if rollup is not supported by the metrics API.
+func ValidateRollup(rollup int64) error {
+	for _, r := range Rollups {
+		if rollup == r {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported rollup %ds, must be one of %v", rollup, Rollups)
+}
+
+// ListMetricsRange retrieves the metrics between from and to (in ms) splitting the range into as many
+// calls as required to stay within MaxPointsPerCall. Series are merged by snapshot ID with duplicate
+// points at the call boundaries removed. A rollup of 0 selects one automatically using AutoRollup.
+// If api reports a *PartialError the merged results are returned with the last such error. Ranges that
+// need more than MaxRangeCalls calls at rollup are rejected with an error suggesting a coarser rollup.
+func ListMetricsRange(ctx context.Context, api InfraQueryContext, queryString string, pluginType string, metrics []string, from int64, to int64, rollup int64) ([]openapi.MetricItem, error) {
+	if to <= from {
+		return nil, fmt.Errorf("invalid range, to (%d) must be after from (%d)", to, from)
+	}
+	if rollup == 0 {
+		rollup = AutoRollup(to - from)
+	}
+	err := ValidateRollup(rollup)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunkSize = rollup * 1000 * MaxPointsPerCall
+	if calls := rangeCalls(to-from, rollup); calls > MaxRangeCalls {
+		return nil, fmt.Errorf("range of %v requires %d calls at a rollup of %ds, the maximum is %d, %s", time.Duration(to-from)*time.Millisecond, calls, rollup, MaxRangeCalls, coarserRollup(to-from, rollup))
+	}
+
+	var merged []openapi.MetricItem
+	var index = make(map[string]int)
+	var partial *PartialError
+
+	for end := to; end > from; end -= chunkSize {
+		windowSize := chunkSize
+		if end-from < windowSize {
+			windowSize = end - from
+		}
+
+		items, err := api.ListMetricsContext(ctx, queryString, pluginType, metrics, rollup, windowSize, end)
+		if errors.Is(err, ErrNoMetrics) {
+			continue
+		}
+		var pe *PartialError
+		if errors.As(err, &pe) && !pe.Complete() {
+			partial = pe
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			i, ok := index[item.SnapshotId]
+			if !ok {
+				index[item.SnapshotId] = len(merged)
+				merged = append(merged, copyItem(item))
+				continue
+			}
+			mergeItem(&merged[i], item)
+		}
+	}
+
+	if len(merged) < 1 {
+		if partial != nil {
+			return nil, partial
+		}
+		return nil, ErrNoMetrics
+	}
+
+	for i := range merged {
+		for name, series := range merged[i].Metrics {
+			merged[i].Metrics[name] = dedupePoints(series)
+		}
+	}
+
+	if partial != nil {
+		return merged, partial
+	}
+	return merged, nil
+}
+
+// rangeCalls returns the number of calls needed to retrieve a range of d ms at rollup.
+func rangeCalls(d int64, rollup int64) int64 {
+	chunkSize := rollup * 1000 * MaxPointsPerCall
+	return (d + chunkSize - 1) / chunkSize
+}
+
+// coarserRollup suggests the smallest rollup above rollup that retrieves a range of d ms within
+// MaxRangeCalls calls.
+func coarserRollup(d int64, rollup int64) string {
+	for _, r := range Rollups {
+		if r > rollup && rangeCalls(d, r) <= MaxRangeCalls {
+			return fmt.Sprintf("use a rollup of %ds or more", r)
+		}
+	}
+	return "use a shorter range"
+}
+
+// copyItem copies item with a metrics map that is safe to modify.
+func copyItem(item openapi.MetricItem) openapi.MetricItem {
+	metrics := make(map[string][][]float64, len(item.Metrics))
+	for name, series := range item.Metrics {
+		metrics[name] = append([][]float64(nil), series...)
+	}
+	item.Metrics = metrics
+	return item
+}
+
+// mergeItem appends the series of src to dst and widens its time range.
+func mergeItem(dst *openapi.MetricItem, src openapi.MetricItem) {
+	if src.From != 0 && (dst.From == 0 || src.From < dst.From) {
+		dst.From = src.From
+	}
+	if src.To > dst.To {
+		dst.To = src.To
+	}
+	for name, series := range src.Metrics {
+		dst.Metrics[name] = append(dst.Metrics[name], series...)
+	}
+}
+
+// dedupePoints orders points by timestamp keeping the first of any duplicate timestamps.
+func dedupePoints(series [][]float64) [][]float64 {
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i][0] < series[j][0]
+	})
+
+	var deduped = series[:0]
+	for _, p := range series {
+		if len(deduped) > 0 && deduped[len(deduped)-1][0] == p[0] {
+			continue
+		}
+		deduped = append(deduped, p)
+	}
+	return deduped
+}
@@ -0,0 +1,155 @@
+package instana_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nfisher/instana-crib"
+	"github.com/nfisher/instana-crib/pkg/instana/openapi"
+)
+
+type windowCall struct {
+	Rollup     int64
+	WindowSize int64
+	To         int64
+}
+
+// pointsPerWindow returns a point per rollup for every snapshot with the window boundaries inclusive.
+type pointsPerWindow struct {
+	snapshots []string
+	calls     []windowCall
+}
+
+func (p *pointsPerWindow) ListMetricsContext(ctx context.Context, queryString string, pluginType string, metrics []string, rollup int64, windowSize int64, to int64) ([]openapi.MetricItem, error) {
+	p.calls = append(p.calls, windowCall{rollup, windowSize, to})
+	var items []openapi.MetricItem
+	for _, id := range p.snapshots {
+		var series [][]float64
+		for ts := to - windowSize; ts <= to; ts += rollup * 1000 {
+			series = append(series, []float64{float64(ts), float64(ts / 1000)})
+		}
+		items = append(items, openapi.MetricItem{
+			SnapshotId: id,
+			Metrics:    map[string][][]float64{metrics[0]: series},
+		})
+	}
+	if len(items) < 1 {
+		return nil, instana.ErrNoMetrics
+	}
+	return items, nil
+}
+
+func (p *pointsPerWindow) ListSnapshotsContext(ctx context.Context, queryString string, pluginType string, windowSize int64) ([]openapi.SnapshotItem, error) {
+	return nil, nil
+}
+
+func Test_RollupForWindow(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		window   string
+		expected int64
+		hasError bool
+	}{
+		"minute":     {"1m", 1, false},
+		"hour":       {"1h", 60, false},
+		"50 minutes": {"50m", 5, false},
+		"day":        {"24h", 300, false},
+		"week":       {"168h", 3600, false},
+		"25 days":    {"600h", 3600, false},
+		"90 days":    {"2160h", 0, true},
+		"10 minutes": {"10m", 1, false},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			window, err := instana.ParseDuration(tc.window)
+			if err != nil {
+				t.Fatalf("ParseDuration(%v) error = %v", tc.window, err)
+			}
+			actual, err := instana.RollupForWindow(window)
+			if (err != nil) != tc.hasError {
+				t.Errorf("RollupForWindow(%v) error = %v, want error %v", tc.window, err, tc.hasError)
+			}
+			if actual != tc.expected {
+				t.Errorf("RollupForWindow(%v) = %v, want %v", tc.window, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func Test_ListMetricsRange_stitches_windows(t *testing.T) {
+	t.Parallel()
+
+	const from = 1601553600000
+	const to = from + 1500*1000
+	api := &pointsPerWindow{snapshots: []string{"a", "b"}}
+
+	items, err := instana.ListMetricsRange(context.Background(), api, "entity.zone:test", "host", []string{CpuUser}, from, to, 1)
+	if err != nil {
+		t.Fatalf("ListMetricsRange() error = %v", err)
+	}
+
+	expectedCalls := []windowCall{
+		{1, 600000, to},
+		{1, 600000, to - 600000},
+		{1, 300000, to - 1200000},
+	}
+	if !cmp.Equal(api.calls, expectedCalls) {
+		t.Errorf("calls -got/+want:\n%s", cmp.Diff(expectedCalls, api.calls))
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("len(items) = %v, want 2", len(items))
+	}
+	for _, item := range items {
+		series := item.Metrics[CpuUser]
+		if len(series) != 1501 {
+			t.Errorf("len(%s series) = %v, want 1501", item.SnapshotId, len(series))
+		}
+		for i := 1; i < len(series); i++ {
+			if series[i][0]-series[i-1][0] != 1000 {
+				t.Fatalf("%s series[%d] = %v follows %v, want 1s step", item.SnapshotId, i, series[i][0], series[i-1][0])
+			}
+		}
+	}
+}
+
+func Test_ListMetricsRange_validation(t *testing.T) {
+	t.Parallel()
+
+	td := map[string]struct {
+		from   int64
+		to     int64
+		rollup int64
+	}{
+		"unsupported rollup": {0, 60000, 7},
+		"inverted range":     {60000, 0, 1},
+		"empty range":        {60000, 60000, 1},
+		"too many calls":     {0, 90 * 24 * 3600 * 1000, 1},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			api := &pointsPerWindow{snapshots: []string{"a"}}
+			_, err := instana.ListMetricsRange(context.Background(), api, "", "host", []string{CpuUser}, tc.from, tc.to, tc.rollup)
+			if err == nil {
+				t.Errorf("ListMetricsRange() error = nil, want error")
+			}
+			if len(api.calls) != 0 {
+				t.Errorf("calls = %v, want none", len(api.calls))
+			}
+		})
+	}
+}
+
+func Test_ListMetricsRange_no_metrics(t *testing.T) {
+	t.Parallel()
+
+	api := &pointsPerWindow{}
+	_, err := instana.ListMetricsRange(context.Background(), api, "", "host", []string{CpuUser}, 0, 3600000, 0)
+	if err != instana.ErrNoMetrics {
+		t.Errorf("ListMetricsRange() error = %v, want %v", err, instana.ErrNoMetrics)
+	}
+}